@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/IncSW/geoip2"
+	"github.com/rs/zerolog"
+)
+
+// anonymousFlags are the values accepted by LookupRequest.RejectAnonymous
+var anonymousFlags = []string{
+	"anonymous",
+	"anonymous_vpn",
+	"hosting_provider",
+	"public_proxy",
+	"tor_exit_node",
+}
+
+type AnonymousIPLookupRequest struct {
+	SourceIP string `json:"source_ip"`
+}
+
+func (r AnonymousIPLookupRequest) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("source_ip", r.SourceIP)
+}
+
+type AnonymousIPLookupResult struct {
+	IsAnonymous       bool `json:"is_anonymous"`
+	IsAnonymousVPN    bool `json:"is_anonymous_vpn"`
+	IsHostingProvider bool `json:"is_hosting_provider"`
+	IsPublicProxy     bool `json:"is_public_proxy"`
+	IsTorExitNode     bool `json:"is_tor_exit_node"`
+}
+
+func (r AnonymousIPLookupResult) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Bool("is_anonymous", r.IsAnonymous)
+	ev.Bool("is_anonymous_vpn", r.IsAnonymousVPN)
+	ev.Bool("is_hosting_provider", r.IsHostingProvider)
+	ev.Bool("is_public_proxy", r.IsPublicProxy)
+	ev.Bool("is_tor_exit_node", r.IsTorExitNode)
+}
+
+// Flags returns the names of all flags set on this result
+func (r AnonymousIPLookupResult) Flags() []string {
+	flags := make([]string, 0)
+	if r.IsAnonymous {
+		flags = append(flags, "anonymous")
+	}
+	if r.IsAnonymousVPN {
+		flags = append(flags, "anonymous_vpn")
+	}
+	if r.IsHostingProvider {
+		flags = append(flags, "hosting_provider")
+	}
+	if r.IsPublicProxy {
+		flags = append(flags, "public_proxy")
+	}
+	if r.IsTorExitNode {
+		flags = append(flags, "tor_exit_node")
+	}
+	return flags
+}
+
+func validateAnonymousFlags(in []string) error {
+outer:
+	for _, flag := range in {
+		for _, known := range anonymousFlags {
+			if flag == known {
+				continue outer
+			}
+		}
+		return LookupError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid \"reject_anonymous\" value %q, must be one of %v", flag, anonymousFlags),
+		}
+	}
+	return nil
+}
+
+// rejectedAnonymousFlags returns the subset of reject that is set on the result
+func rejectedAnonymousFlags(res AnonymousIPLookupResult, reject []string) []string {
+	out := make([]string, 0)
+	for _, flag := range res.Flags() {
+		for _, r := range reject {
+			if flag == r {
+				out = append(out, flag)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func newAnonymousIPLookupResult(lookup *geoip2.AnonymousIP) AnonymousIPLookupResult {
+	return AnonymousIPLookupResult{
+		IsAnonymous:       lookup.IsAnonymous,
+		IsAnonymousVPN:    lookup.IsAnonymousVPN,
+		IsHostingProvider: lookup.IsHostingProvider,
+		IsPublicProxy:     lookup.IsPublicProxy,
+		IsTorExitNode:     lookup.IsTorExitNode,
+	}
+}
+
+func anonymousIPLookup(snap *readerSnapshot, ip net.IP) (AnonymousIPLookupResult, error) {
+	reader, err := snap.anonymousIP()
+	if err != nil {
+		return AnonymousIPLookupResult{}, readerLookupError(err)
+	}
+
+	lookup, err := reader.Lookup(ip)
+	if err != nil {
+		// networks absent from the anonymous ip database are simply not anonymous
+		if err == geoip2.ErrNotFound {
+			return AnonymousIPLookupResult{}, nil
+		}
+		return AnonymousIPLookupResult{}, readerLookupError(err)
+	}
+
+	return newAnonymousIPLookupResult(lookup), nil
+}
+
+func (g *geoman) lookupAnonymousIP(req AnonymousIPLookupRequest) (*AnonymousIPLookupResult, error) {
+	var (
+		ip  net.IP
+		res AnonymousIPLookupResult
+		err error
+	)
+
+	g.log.Info().Object("request", req).Msg("Handling anonymous ip lookup request...")
+
+	if ip, err = parseSourceIP(req.SourceIP); err != nil {
+		return nil, err
+	}
+
+	if res, err = anonymousIPLookup(g.registry.snapshot(), ip); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/IncSW/geoip2"
+	"github.com/rs/zerolog"
+)
+
+type ASNLookupRequest struct {
+	SourceIP string `json:"source_ip"`
+}
+
+func (r ASNLookupRequest) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("source_ip", r.SourceIP)
+}
+
+type ASNLookupResult struct {
+	AutonomousSystemNumber       uint32 `json:"autonomous_system_number"`
+	AutonomousSystemOrganization string `json:"autonomous_system_organization"`
+}
+
+// parseASN accepts both "15169" and "AS15169" forms
+func parseASN(target string) (uint32, bool) {
+	if len(target) > 2 && strings.EqualFold(target[:2], "as") {
+		target = target[2:]
+	}
+	asUint, err := strconv.ParseUint(target, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(asUint), true
+}
+
+func matchASN(lookup *geoip2.ASN, targets []string, lt listTrace) LookupResult {
+	res := make(LookupResult, 0)
+
+	for _, target := range uniqueStrings(targets) {
+		if asn, ok := parseASN(target); ok {
+			step := TraceStep{
+				Rule:            "asn",
+				Entry:           target,
+				NormalizedTo:    strconv.FormatUint(uint64(asn), 10),
+				ComparedType:    "asn",
+				ComparedAgainst: strconv.FormatUint(uint64(lookup.AutonomousSystemNumber), 10),
+				Matched:         lookup.AutonomousSystemNumber == asn,
+			}
+			if step.Matched {
+				step.MatchedType = "asn"
+			}
+			lt.add(step)
+
+			if step.Matched {
+				res = append(res, LookupMatch{
+					MatchedType:  "asn",
+					MatchedValue: strconv.FormatUint(uint64(lookup.AutonomousSystemNumber), 10),
+				})
+			}
+			continue
+		}
+
+		step := TraceStep{
+			Rule:            "asn",
+			Entry:           target,
+			ComparedType:    "as_organization",
+			ComparedAgainst: lookup.AutonomousSystemOrganization,
+			Matched:         lookup.AutonomousSystemOrganization != "" && strings.EqualFold(lookup.AutonomousSystemOrganization, target),
+		}
+		if step.Matched {
+			step.MatchedType = "as_organization"
+		}
+		lt.add(step)
+
+		if step.Matched {
+			res = append(res, LookupMatch{
+				MatchedType:  "as_organization",
+				MatchedValue: lookup.AutonomousSystemOrganization,
+			})
+		}
+	}
+
+	return res
+}
+
+func (g *geoman) lookupASN(req ASNLookupRequest) (*ASNLookupResult, error) {
+	var (
+		ip     net.IP
+		reader *geoip2.ASNReader
+		lookup *geoip2.ASN
+		err    error
+	)
+
+	g.log.Info().Object("request", req).Msg("Handling asn lookup request...")
+
+	if ip, err = parseSourceIP(req.SourceIP); err != nil {
+		return nil, err
+	}
+
+	if reader, err = g.registry.snapshot().asn(); err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	if lookup, err = reader.Lookup(ip); err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	return &ASNLookupResult{
+		AutonomousSystemNumber:       lookup.AutonomousSystemNumber,
+		AutonomousSystemOrganization: lookup.AutonomousSystemOrganization,
+	}, nil
+}
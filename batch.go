@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// BatchLookupRequest carries either a list of complete lookup requests, or a list of Source IPs evaluated against
+// one shared policy.  The shared policy is a LookupRequest without a source_ip.
+type BatchLookupRequest struct {
+	Requests  []LookupRequest `json:"requests,omitempty" description:"Lookup requests, each with its own Source IP and lists or policy_id.  Cannot be combined with source_ips."`
+	SourceIPs []string        `json:"source_ips,omitempty" description:"Source IPs evaluated against the shared policy.  Cannot be combined with requests."`
+	Policy    *LookupRequest  `json:"policy,omitempty" description:"Shared policy_id or whitelist / blacklist fields applied to every entry in source_ips"`
+}
+
+func (r BatchLookupRequest) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Int("requests", len(r.Requests))
+	ev.Int("source_ips", len(r.SourceIPs))
+	if r.Policy != nil {
+		ev.Object("policy", r.Policy)
+	}
+}
+
+// BatchLookupItem is the outcome of a single batch entry.  Exactly one of Decision or Error is set.
+type BatchLookupItem struct {
+	SourceIP string          `json:"source_ip"`
+	Decision *LookupDecision `json:"decision,omitempty"`
+	Error    *LookupError    `json:"error,omitempty"`
+}
+
+// BatchLookupResult holds one item per batch entry, in request order
+type BatchLookupResult struct {
+	Results []BatchLookupItem `json:"results"`
+}
+
+// batchBody bounds the request body of a batch or country resolve request to limit bytes, so an oversized request is
+// refused before it is decoded in full.  Batches allow maxStreamLineSize bytes per entry.
+type batchBody struct {
+	io.ReadCloser
+	limit   int64
+	overrun bool
+}
+
+func newBatchBody(w http.ResponseWriter, body io.ReadCloser, limit int64) *batchBody {
+	return &batchBody{ReadCloser: http.MaxBytesReader(w, body, limit), limit: limit}
+}
+
+func (b *batchBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		b.overrun = true
+	}
+	return n, err
+}
+
+// exceeded returns true once a read went past the allowed body size.  A body of exactly the allowed size is not
+// exceeded.
+func (b *batchBody) exceeded() bool {
+	return b.overrun
+}
+
+func (b *batchBody) tooLargeError() error {
+	return LookupError{
+		Code:    http.StatusRequestEntityTooLarge,
+		Message: fmt.Sprintf("Request bodies are limited to %d bytes", b.limit),
+	}
+}
+
+// batchItemError converts an evaluation error into a per-item error
+func batchItemError(err error) *LookupError {
+	if lerr, ok := err.(LookupError); ok {
+		return &lerr
+	}
+	return &LookupError{
+		Code:    http.StatusInternalServerError,
+		Message: "Error looking up IP",
+		Err:     err,
+	}
+}
+
+func (g *geoman) lookupBatch(req BatchLookupRequest) (*BatchLookupResult, error) {
+	var (
+		size     int
+		policies []Policy
+		sources  []string
+		opts     []evaluateOptions
+		errs     []error
+	)
+
+	g.log.Info().Object("request", req).Msg("Handling batch lookup request...")
+
+	if len(req.Requests) > 0 && (len(req.SourceIPs) > 0 || req.Policy != nil) {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "\"requests\" cannot be combined with \"source_ips\" or \"policy\"",
+		}
+	}
+
+	if len(req.Requests) > 0 {
+		size = len(req.Requests)
+	} else {
+		size = len(req.SourceIPs)
+	}
+
+	if size == 0 {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "\"requests\" or \"source_ips\" must be provided",
+		}
+	}
+
+	if size > g.maxBatchSize {
+		return nil, LookupError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Batch contains %d entries, the maximum is %d", size, g.maxBatchSize),
+		}
+	}
+
+	policies = make([]Policy, size)
+	sources = make([]string, size)
+	opts = make([]evaluateOptions, size)
+	errs = make([]error, size)
+
+	if len(req.Requests) > 0 {
+		for i, r := range req.Requests {
+			sources[i] = r.SourceIP
+			opts[i] = r.evaluateOptions()
+			policies[i], errs[i] = g.requestPolicy(r)
+		}
+	} else {
+		if req.Policy == nil {
+			return nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "\"policy\" must be provided with \"source_ips\"",
+			}
+		}
+		if req.Policy.SourceIP != "" {
+			return nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "\"policy\" cannot contain a \"source_ip\"",
+			}
+		}
+		shared, err := g.requestPolicy(*req.Policy)
+		if err != nil {
+			return nil, err
+		}
+		copy(sources, req.SourceIPs)
+		for i := range policies {
+			policies[i] = shared
+			opts[i] = req.Policy.evaluateOptions()
+		}
+	}
+
+	return g.evaluateBatch(sources, policies, opts, errs), nil
+}
+
+// evaluateBatch evaluates every entry without a prior error in parallel, all against the same reader snapshot so
+// a database swap mid-batch cannot produce mixed results
+func (g *geoman) evaluateBatch(sources []string, policies []Policy, opts []evaluateOptions, errs []error) *BatchLookupResult {
+	var (
+		wg sync.WaitGroup
+
+		snap    = g.registry.snapshot()
+		res     = &BatchLookupResult{Results: make([]BatchLookupItem, len(sources))}
+		work    = make(chan int)
+		workers = runtime.GOMAXPROCS(0)
+	)
+
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				item := BatchLookupItem{SourceIP: sources[i]}
+				if errs[i] != nil {
+					item.Error = batchItemError(errs[i])
+				} else if dec, err := g.evaluateWithContext(snap, sources[i], policies[i], opts[i]); err != nil {
+					item.Error = batchItemError(err)
+				} else {
+					item.Decision = dec
+				}
+				res.Results[i] = item
+			}
+		}()
+	}
+
+	for i := range sources {
+		work <- i
+	}
+	close(work)
+
+	wg.Wait()
+
+	return res
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchBodyExceeded(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		want bool
+	}{
+		{name: "under the limit", size: maxStreamLineSize - 1, want: false},
+		{name: "exactly the limit", size: maxStreamLineSize, want: false},
+		{name: "over the limit", size: maxStreamLineSize + 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := ioutil.NopCloser(strings.NewReader(strings.Repeat("x", tt.size)))
+			body := newBatchBody(httptest.NewRecorder(), in, maxStreamLineSize)
+			_, err := io.Copy(ioutil.Discard, body)
+			if got := body.exceeded(); got != tt.want {
+				t.Errorf("exceeded() = %t, want %t (read error %v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/IncSW/geoip2"
+)
+
+type catalogCountry struct {
+	GeoNameID     uint32
+	ISOCode       string
+	Names         map[string]string
+	ContinentCode string
+}
+
+type catalogContinent struct {
+	GeoNameID uint32
+	Code      string
+	Names     map[string]string
+}
+
+// countryCatalog holds every country and continent named in an edition's data section
+type countryCatalog struct {
+	countries  map[string]*catalogCountry
+	continents map[string]*catalogContinent
+}
+
+func catalogNames(v interface{}) map[string]string {
+	raw, _ := v.(map[string]interface{})
+	out := make(map[string]string, len(raw))
+	for locale, name := range raw {
+		if ns, ok := name.(string); ok {
+			out[locale] = ns
+		}
+	}
+	return out
+}
+
+func (c *countryCatalog) addCountry(v interface{}, continentCode string) {
+	raw, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	iso, _ := raw["iso_code"].(string)
+	if iso == "" {
+		return
+	}
+	cc, ok := c.countries[iso]
+	if !ok {
+		cc = &catalogCountry{ISOCode: iso, Names: make(map[string]string)}
+		c.countries[iso] = cc
+	}
+	if id, ok := raw["geoname_id"].(uint32); ok {
+		cc.GeoNameID = id
+	}
+	for locale, name := range catalogNames(raw["names"]) {
+		cc.Names[locale] = name
+	}
+	if cc.ContinentCode == "" {
+		cc.ContinentCode = continentCode
+	}
+}
+
+func (c *countryCatalog) addContinent(v interface{}) string {
+	raw, ok := v.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := raw["code"].(string)
+	if code == "" {
+		return ""
+	}
+	cc, ok := c.continents[code]
+	if !ok {
+		cc = &catalogContinent{Code: code, Names: make(map[string]string)}
+		c.continents[code] = cc
+	}
+	if id, ok := raw["geoname_id"].(uint32); ok {
+		cc.GeoNameID = id
+	}
+	for locale, name := range catalogNames(raw["names"]) {
+		cc.Names[locale] = name
+	}
+	return code
+}
+
+// buildCountryCatalog walks the entire data section of a country or city edition.  This is slow for large
+// editions, so the result is cached on the editionReader and built at most once per build.
+func buildCountryCatalog(er *editionReader) (*countryCatalog, error) {
+	c := &countryCatalog{
+		countries:  make(map[string]*catalogCountry),
+		continents: make(map[string]*catalogContinent),
+	}
+
+	err := walkMMDBData(er.buf, er.metadata, func(v interface{}) {
+		record, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		continentCode := c.addContinent(record["continent"])
+		c.addCountry(record["country"], continentCode)
+		c.addCountry(record["registered_country"], "")
+		c.addCountry(record["represented_country"], "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// catalogCache holds the country catalog of a single build
+type catalogCache struct {
+	once    sync.Once
+	catalog *countryCatalog
+	err     error
+}
+
+func (er *editionReader) countryCatalog() (*countryCatalog, error) {
+	er.catalog.once.Do(func() {
+		er.catalog.catalog, er.catalog.err = buildCountryCatalog(er)
+	})
+	return er.catalog.catalog, er.catalog.err
+}
+
+// sortedCountries returns the catalog countries ordered by ISO code
+func (c *countryCatalog) sortedCountries() []*catalogCountry {
+	out := make([]*catalogCountry, 0, len(c.countries))
+	for _, cc := range c.countries {
+		out = append(out, cc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ISOCode < out[j].ISOCode })
+	return out
+}
+
+func (c *countryCatalog) countryByGeoNameID(id uint32) (*catalogCountry, bool) {
+	for _, cc := range c.countries {
+		if cc.GeoNameID == id {
+			return cc, true
+		}
+	}
+	return nil, false
+}
+
+func geoip2Country(cc *catalogCountry) geoip2.Country {
+	return geoip2.Country{GeoNameID: cc.GeoNameID, ISOCode: cc.ISOCode, Names: cc.Names}
+}
+
+func geoip2Continent(cc *catalogContinent) geoip2.Continent {
+	return geoip2.Continent{GeoNameID: cc.GeoNameID, Code: cc.Code, Names: cc.Names}
+}
+
+// sortedContinents returns the catalog continents ordered by code
+func (c *countryCatalog) sortedContinents() []*catalogContinent {
+	out := make([]*catalogContinent, 0, len(c.continents))
+	for _, cc := range c.continents {
+		out = append(out, cc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+type CatalogCountryRecord struct {
+	GeoNameID     uint32            `json:"geo_name_id"`
+	ISOCode       string            `json:"iso_code"`
+	Name          string            `json:"name"`
+	Names         map[string]string `json:"names"`
+	ContinentCode string            `json:"continent_code,omitempty"`
+}
+
+// CountryCatalogResult lists every country and continent named in the loaded database, with each Name in Locale
+type CountryCatalogResult struct {
+	Locale     string                 `json:"locale"`
+	Database   *DatabaseInfo          `json:"database"`
+	Countries  []CatalogCountryRecord `json:"countries"`
+	Continents []ContinentRecord      `json:"continents"`
+}
+
+func (g *geoman) countryCatalog(locale string) (*CountryCatalogResult, error) {
+	g.log.Info().Str("locale", locale).Msg("Handling country catalog request...")
+
+	er, err := g.registry.snapshot().countryEdition()
+	if err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	cat, err := er.countryCatalog()
+	if err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	res := &CountryCatalogResult{
+		Locale:     negotiateLocale(locale, er.metadata.Languages),
+		Database:   newDatabaseInfo(er),
+		Countries:  make([]CatalogCountryRecord, 0, len(cat.countries)),
+		Continents: make([]ContinentRecord, 0, len(cat.continents)),
+	}
+
+	for _, cc := range cat.sortedCountries() {
+		res.Countries = append(res.Countries, CatalogCountryRecord{
+			GeoNameID:     cc.GeoNameID,
+			ISOCode:       cc.ISOCode,
+			Name:          localizedName(cc.Names, res.Locale),
+			Names:         cc.Names,
+			ContinentCode: cc.ContinentCode,
+		})
+	}
+
+	for _, cc := range cat.sortedContinents() {
+		res.Continents = append(res.Continents, ContinentRecord{
+			GeoNameID: cc.GeoNameID,
+			Code:      cc.Code,
+			Name:      localizedName(cc.Names, res.Locale),
+			Names:     cc.Names,
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net"
+
+	"github.com/IncSW/geoip2"
+	"github.com/rs/zerolog"
+)
+
+type CityLookupRequest struct {
+	SourceIP string `json:"source_ip"`
+	Locale   string `json:"locale,omitempty" description:"Locale of returned names, e.g. \"de\" or \"pt-BR\".  Defaults to the request's Accept-Language header, falling back to English."`
+}
+
+func (r CityLookupRequest) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("source_ip", r.SourceIP)
+	ev.Str("locale", r.Locale)
+}
+
+type CityRecord struct {
+	GeoNameID  uint32            `json:"geo_name_id"`
+	Name       string            `json:"name"`
+	Names      map[string]string `json:"names"`
+	Confidence uint16            `json:"confidence"`
+}
+
+type SubdivisionRecord struct {
+	GeoNameID  uint32            `json:"geo_name_id"`
+	ISOCode    string            `json:"iso_code"`
+	Name       string            `json:"name"`
+	Names      map[string]string `json:"names"`
+	Confidence uint16            `json:"confidence"`
+}
+
+type CityLocation struct {
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	AccuracyRadius uint16  `json:"accuracy_radius"`
+	TimeZone       string  `json:"time_zone"`
+}
+
+// CityLookupResult holds the city data of the Source IP, each Name is in Locale
+type CityLookupResult struct {
+	Locale       string              `json:"locale"`
+	City         CityRecord          `json:"city"`
+	Subdivisions []SubdivisionRecord `json:"subdivisions"`
+	PostalCode   string              `json:"postal_code"`
+	Location     CityLocation        `json:"location"`
+	MetroCode    uint16              `json:"metro_code"`
+}
+
+func newCityLookupResult(lookup *geoip2.CityResult, locale string) CityLookupResult {
+	res := CityLookupResult{
+		Locale: locale,
+		City: CityRecord{
+			GeoNameID:  lookup.City.GeoNameID,
+			Name:       localizedName(lookup.City.Names, locale),
+			Names:      lookup.City.Names,
+			Confidence: lookup.City.Confidence,
+		},
+		Subdivisions: make([]SubdivisionRecord, len(lookup.Subdivisions)),
+		PostalCode:   lookup.Postal.Code,
+		Location: CityLocation{
+			Latitude:       lookup.Location.Latitude,
+			Longitude:      lookup.Location.Longitude,
+			AccuracyRadius: lookup.Location.AccuracyRadius,
+			TimeZone:       lookup.Location.TimeZone,
+		},
+		MetroCode: lookup.Location.MetroCode,
+	}
+	for i, sub := range lookup.Subdivisions {
+		res.Subdivisions[i] = SubdivisionRecord{
+			GeoNameID:  sub.GeoNameID,
+			ISOCode:    sub.ISOCode,
+			Name:       localizedName(sub.Names, locale),
+			Names:      sub.Names,
+			Confidence: sub.Confidence,
+		}
+	}
+	return res
+}
+
+func (g *geoman) lookupCity(req CityLookupRequest) (*CityLookupResult, error) {
+	var (
+		ip     net.IP
+		er     *editionReader
+		lookup *geoip2.CityResult
+		err    error
+	)
+
+	g.log.Info().Object("request", req).Msg("Handling city lookup request...")
+
+	if ip, err = parseSourceIP(req.SourceIP); err != nil {
+		return nil, err
+	}
+
+	if er, err = g.registry.snapshot().byType(cityDatabaseTypes...); err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	if lookup, err = er.reader.(*geoip2.CityReader).Lookup(ip); err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	res := newCityLookupResult(lookup, negotiateLocale(req.Locale, er.metadata.Languages))
+
+	return &res, nil
+}
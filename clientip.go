@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseTrustedProxies parses a comma separated list of CIDRs.  Bare IPs are treated as single host networks.
+func parseTrustedProxies(in string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(in, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			if ip.To4() != nil {
+				entry = fmt.Sprintf("%s/32", entry)
+			} else {
+				entry = fmt.Sprintf("%s/128", entry)
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		out = append(out, ipNet)
+	}
+	return out, nil
+}
+
+func isTrustedProxy(trusted []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHostIP parses an address that may carry a port, with or without brackets around IPv6 addresses.  The zone of
+// a link-local IPv6 address is dropped.
+func parseHostIP(addr string) net.IP {
+	addr = strings.Trim(strings.TrimSpace(addr), `"`)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.Trim(addr, "[]")
+	if i := strings.LastIndexByte(addr, '%'); i >= 0 {
+		addr = addr[:i]
+	}
+	return net.ParseIP(addr)
+}
+
+// forwardedFor returns the "for" addresses of an RFC 7239 Forwarded header, nearest client first.  Obfuscated or
+// unknown identifiers are returned as-is and will fail to parse as an IP.
+func forwardedFor(values []string) []string {
+	out := make([]string, 0)
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					out = append(out, kv[1])
+				}
+			}
+		}
+	}
+	return out
+}
+
+func splitHeaderList(values []string) []string {
+	out := make([]string, 0)
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				out = append(out, entry)
+			}
+		}
+	}
+	return out
+}
+
+// clientIP determines the address of the caller.  Forwarding headers are only honored when the connecting peer is a
+// trusted proxy, in which case the chain of hops is walked from the nearest one back, stopping at the first address
+// that is not a trusted proxy.  Forwarded takes precedence over X-Forwarded-For, which takes precedence over
+// X-Real-IP, each only when it names any addresses.
+func clientIP(r *http.Request, trusted []*net.IPNet) (net.IP, error) {
+	var hops []string
+
+	remote := parseHostIP(r.RemoteAddr)
+	if remote == nil {
+		return nil, fmt.Errorf("unable to parse remote address %q", r.RemoteAddr)
+	}
+
+	if !isTrustedProxy(trusted, remote) {
+		return remote, nil
+	}
+
+	// a Forwarded header without any for= addresses, e.g. only proto=https, says nothing about the client
+	if hops = forwardedFor(r.Header.Values("Forwarded")); len(hops) == 0 {
+		if hops = splitHeaderList(r.Header.Values("X-Forwarded-For")); len(hops) == 0 {
+			if xri := r.Header.Get("X-Real-IP"); xri != "" {
+				hops = []string{xri}
+			}
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHostIP(hops[i])
+		if ip == nil {
+			// a hop we cannot parse cannot be verified, so the last verified hop is the best we know
+			break
+		}
+		client = ip
+		if !isTrustedProxy(trusted, ip) {
+			break
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: []string{}},
+		{name: "bare ipv4", in: "10.0.0.1", want: []string{"10.0.0.1/32"}},
+		{name: "bare ipv6", in: "2001:db8::1", want: []string{"2001:db8::1/128"}},
+		{name: "cidrs", in: "10.0.0.0/8, 2001:db8::/32", want: []string{"10.0.0.0/8", "2001:db8::/32"}},
+		{name: "mixed with blank entries", in: " 10.0.0.1 ,, 192.168.0.0/16,", want: []string{"10.0.0.1/32", "192.168.0.0/16"}},
+		{name: "cidr is masked", in: "10.1.2.3/8", want: []string{"10.0.0.0/8"}},
+		{name: "malformed ip", in: "10.0.0", wantErr: true},
+		{name: "malformed cidr", in: "10.0.0.0/33", wantErr: true},
+		{name: "hostname", in: "proxy.example.com", wantErr: true},
+		{name: "one malformed entry", in: "10.0.0.1,nope", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTrustedProxies(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTrustedProxies(%q) error = %v, wantErr %t", tt.in, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseTrustedProxies(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("parseTrustedProxies(%q)[%d] = %s, want %s", tt.in, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.1, fe80::/10")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "no proxy",
+			remoteAddr: "203.0.113.7:51234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer sending x-forwarded-for",
+			remoteAddr: "203.0.113.7:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer sending forwarded",
+			remoteAddr: "203.0.113.7:51234",
+			header:     http.Header{"Forwarded": {"for=8.8.8.8"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted cidr proxy",
+			remoteAddr: "10.1.1.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8"}},
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "trusted bare ip proxy",
+			remoteAddr: "192.168.1.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8"}},
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "bare ip proxy entry does not trust its network",
+			remoteAddr: "192.168.1.2:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8"}},
+			want:       "192.168.1.2",
+		},
+		{
+			name:       "chain of trusted hops",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8, 10.0.0.3", "10.0.0.2"}},
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "spoofed entry before an untrusted hop",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"1.2.3.4, 8.8.8.8, 10.0.0.2"}},
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "every hop trusted",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "forwarded takes precedence",
+			remoteAddr: "10.0.0.1:51234",
+			header: http.Header{
+				"Forwarded":       {`for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`},
+				"X-Forwarded-For": {"8.8.8.8"},
+			},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			name:       "forwarded without for falls through to x-forwarded-for",
+			remoteAddr: "10.0.0.1:51234",
+			header: http.Header{
+				"Forwarded":       {"proto=https;host=example.com"},
+				"X-Forwarded-For": {"8.8.8.8"},
+			},
+			want: "8.8.8.8",
+		},
+		{
+			name:       "forwarded without for falls through to x-real-ip",
+			remoteAddr: "10.0.0.1:51234",
+			header: http.Header{
+				"Forwarded": {"proto=https"},
+				"X-Real-Ip": {"8.8.8.8"},
+			},
+			want: "8.8.8.8",
+		},
+		{
+			name:       "x-real-ip",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Real-Ip": {"8.8.8.8"}},
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "malformed nearest hop",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8, not-an-ip"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "malformed hop behind a trusted one",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8, garbage, 10.0.0.2"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "obfuscated forwarded identifier",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"Forwarded": {"for=_hidden"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "ipv6 peer with a zone",
+			remoteAddr: "[fe80::1%eth0]:51234",
+			header:     http.Header{"X-Forwarded-For": {"2001:4860::8888"}},
+			want:       "2001:4860::8888",
+		},
+		{
+			name:       "ipv6 hop with a zone",
+			remoteAddr: "10.0.0.1:51234",
+			header:     http.Header{"X-Forwarded-For": {"fe80::2%eth0"}},
+			want:       "fe80::2",
+		},
+		{
+			name:       "untrusted ipv6 peer",
+			remoteAddr: "[2001:db8::1]:51234",
+			header:     http.Header{"X-Forwarded-For": {"8.8.8.8"}},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "malformed remote address",
+			remoteAddr: "not-an-address",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.header}
+			if r.Header == nil {
+				r.Header = make(http.Header)
+			}
+			got, err := clientIP(r, trusted)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientIP() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
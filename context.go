@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/IncSW/geoip2"
+)
+
+// Values accepted by LookupRequest.Include
+const (
+	IncludeGeo      = "geo"
+	IncludeDatabase = "database"
+)
+
+var includeValues = []string{IncludeGeo, IncludeDatabase}
+
+func validateInclude(in []string) error {
+outer:
+	for _, v := range in {
+		for _, known := range includeValues {
+			if v == known {
+				continue outer
+			}
+		}
+		return LookupError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid \"include\" value %q, must be one of %v", v, includeValues),
+		}
+	}
+	return nil
+}
+
+func hasInclude(include []string, v string) bool {
+	for _, i := range include {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+type CountryRecord struct {
+	GeoNameID         uint32            `json:"geo_name_id"`
+	ISOCode           string            `json:"iso_code"`
+	Name              string            `json:"name"`
+	Names             map[string]string `json:"names"`
+	IsInEuropeanUnion bool              `json:"is_in_european_union"`
+	Type              string            `json:"type,omitempty"`
+	Confidence        uint16            `json:"confidence"`
+}
+
+type ContinentRecord struct {
+	GeoNameID uint32            `json:"geo_name_id"`
+	Code      string            `json:"code"`
+	Name      string            `json:"name"`
+	Names     map[string]string `json:"names"`
+}
+
+type TraitsRecord struct {
+	IsAnonymousProxy    bool `json:"is_anonymous_proxy"`
+	IsSatelliteProvider bool `json:"is_satellite_provider"`
+	IsLegitimateProxy   bool `json:"is_legitimate_proxy"`
+}
+
+// GeoContext describes where the Source IP resolved to, regardless of whether any entry matched.  Records absent
+// from the database are omitted.  Each record's Name is in Locale.
+type GeoContext struct {
+	Locale             string           `json:"locale"`
+	Country            *CountryRecord   `json:"country,omitempty"`
+	Continent          *ContinentRecord `json:"continent,omitempty"`
+	RegisteredCountry  *CountryRecord   `json:"registered_country,omitempty"`
+	RepresentedCountry *CountryRecord   `json:"represented_country,omitempty"`
+	Traits             TraitsRecord     `json:"traits"`
+}
+
+// DatabaseInfo identifies the edition a lookup was answered from
+type DatabaseInfo struct {
+	EditionID    string    `json:"edition_id"`
+	DatabaseType string    `json:"database_type"`
+	BuildEpoch   uint64    `json:"build_epoch"`
+	BuildTime    time.Time `json:"build_time"`
+	LoadedAt     time.Time `json:"loaded_at"`
+}
+
+func newCountryRecord(country geoip2.Country, locale string) *CountryRecord {
+	if country.GeoNameID == 0 && country.ISOCode == "" {
+		return nil
+	}
+	return &CountryRecord{
+		GeoNameID:         country.GeoNameID,
+		ISOCode:           country.ISOCode,
+		Name:              localizedName(country.Names, locale),
+		Names:             country.Names,
+		IsInEuropeanUnion: country.IsInEuropeanUnion,
+		Type:              country.Type,
+		Confidence:        country.Confidence,
+	}
+}
+
+func newGeoContext(lookup *geoip2.CountryResult, locale string) *GeoContext {
+	gc := &GeoContext{
+		Locale:             locale,
+		Country:            newCountryRecord(lookup.Country, locale),
+		RegisteredCountry:  newCountryRecord(lookup.RegisteredCountry, locale),
+		RepresentedCountry: newCountryRecord(lookup.RepresentedCountry, locale),
+		Traits: TraitsRecord{
+			IsAnonymousProxy:    lookup.Traits.IsAnonymousProxy,
+			IsSatelliteProvider: lookup.Traits.IsSatelliteProvider,
+			IsLegitimateProxy:   lookup.Traits.IsLegitimateProxy,
+		},
+	}
+	if lookup.Continent.GeoNameID != 0 || lookup.Continent.Code != "" {
+		gc.Continent = &ContinentRecord{
+			GeoNameID: lookup.Continent.GeoNameID,
+			Code:      lookup.Continent.Code,
+			Name:      localizedName(lookup.Continent.Names, locale),
+			Names:     lookup.Continent.Names,
+		}
+	}
+	return gc
+}
+
+func newDatabaseInfo(er *editionReader) *DatabaseInfo {
+	return &DatabaseInfo{
+		EditionID:    er.editionID,
+		DatabaseType: er.metadata.DatabaseType,
+		BuildEpoch:   er.metadata.BuildEpoch,
+		BuildTime:    time.Unix(int64(er.metadata.BuildEpoch), 0).UTC(),
+		LoadedAt:     er.loadedAt,
+	}
+}
+
+// includeContext adds the requested context to a decision, with names in the locale best matching the requested
+// one.  An IP absent from the database simply has no geo context.
+func includeContext(dec *LookupDecision, snap *readerSnapshot, sourceIP string, include []string, locale string) error {
+	if len(include) == 0 {
+		return nil
+	}
+
+	er, err := snap.countryEdition()
+	if err != nil {
+		return readerLookupError(err)
+	}
+
+	if hasInclude(include, IncludeDatabase) {
+		dec.Database = newDatabaseInfo(er)
+	}
+
+	if hasInclude(include, IncludeGeo) {
+		lookup, err := snap.countryLookup(net.ParseIP(sourceIP))
+		if err == geoip2.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return readerLookupError(err)
+		}
+		dec.Geo = newGeoContext(lookup, negotiateLocale(locale, er.metadata.Languages))
+	}
+
+	return nil
+}
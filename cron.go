@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField describes one of the five fields of a cron expression
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string // names[i] is an alias for min+i
+}
+
+var (
+	cronMinute     = cronField{name: "minute", min: 0, max: 59}
+	cronHour       = cronField{name: "hour", min: 0, max: 23}
+	cronDayOfMonth = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth      = cronField{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// day of week accepts 7 as well as 0 for sunday
+	cronDayOfWeek = cronField{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// cronMacros are the supported shorthand expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSchedule is a parsed five field cron expression: minute, hour, day of month, month and day of week.  Each
+// field is a bitset of the values it matches.
+type cronSchedule struct {
+	expr       string
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+
+	// as in most cron implementations, when both day fields are restricted a day matching either one matches
+	dayOfMonthStar bool
+	dayOfWeekStar  bool
+}
+
+// parseCron parses expressions such as "0 4 * * 3", "*/15 9-17 * * mon-fri" or "@weekly".  Fields accept "*",
+// values, ranges, comma separated lists and "/" steps, and month and day of week fields accept three letter names.
+func parseCron(expr string) (*cronSchedule, error) {
+	var err error
+
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, found %d", expr, len(fields))
+	}
+
+	cs := &cronSchedule{
+		expr:           expr,
+		dayOfMonthStar: strings.HasPrefix(fields[2], "*"),
+		dayOfWeekStar:  strings.HasPrefix(fields[4], "*"),
+	}
+
+	if cs.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, err
+	}
+	if cs.hour, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, err
+	}
+	if cs.dayOfMonth, err = parseCronField(fields[2], cronDayOfMonth); err != nil {
+		return nil, err
+	}
+	if cs.month, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, err
+	}
+	if cs.dayOfWeek, err = parseCronField(fields[4], cronDayOfWeek); err != nil {
+		return nil, err
+	}
+
+	// fold 7 into 0, both are sunday
+	if cs.dayOfWeek&(1<<7) != 0 {
+		cs.dayOfWeek = cs.dayOfWeek&^(1<<7) | 1
+	}
+
+	return cs, nil
+}
+
+func parseCronField(expr string, f cronField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(expr, ",") {
+		var (
+			lo, hi = f.min, f.max
+			step   = 1
+			err    error
+		)
+
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in cron %s field %q", f.name, part)
+			}
+		}
+
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = parseCronValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in cron %s field %q", f.name, part)
+			}
+		default:
+			if lo, err = parseCronValue(rng, f); err != nil {
+				return 0, err
+			}
+			// "5/15" runs from 5 to the end of the range, a bare value matches only itself
+			if rng == part {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(in string, f cronField) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(in, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(in)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q in cron %s field, must be between %d and %d", in, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (cs *cronSchedule) String() string {
+	return cs.expr
+}
+
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	dom := cs.dayOfMonth&(1<<uint(t.Day())) != 0
+	dow := cs.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if cs.dayOfMonthStar || cs.dayOfWeekStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t, in t's location, matching the schedule.  The zero time is returned for
+// schedules that never match, such as "0 0 30 2 *".
+//
+// Hours are stepped in absolute time rather than by rebuilding the wall clock time, as a wall clock time skipped
+// when clocks go forward normalizes back to the instant it was built from.  Local times skipped that way never match.
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case cs.month&(1<<uint(t.Month())) == 0:
+			t = advanceTo(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !cs.dayMatches(t):
+			t = advanceTo(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case cs.hour&(1<<uint(t.Hour())) == 0:
+			t = nextHour(t)
+		case cs.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// nextHour returns the start of the wall clock hour after t, which must be truncated to the minute
+func nextHour(t time.Time) time.Time {
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// advanceTo returns next, a local midnight, unless that midnight does not exist in its location and was normalized
+// to an instant that is not after t.  The start of the next hour is returned instead, so that t always moves forward.
+func advanceTo(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return nextHour(t)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "every minute", expr: "* * * * *"},
+		{name: "fixed time", expr: "0 4 * * 3"},
+		{name: "steps ranges and names", expr: "*/15 9-17 * * mon-fri"},
+		{name: "list", expr: "0,30 0 1,15 jan,jul *"},
+		{name: "sunday as 7", expr: "0 0 * * 7"},
+		{name: "macro", expr: "@weekly"},
+		{name: "macro upper case", expr: "@DAILY"},
+		{name: "too few fields", expr: "0 4 * *", wantErr: true},
+		{name: "too many fields", expr: "0 4 * * * *", wantErr: true},
+		{name: "minute out of range", expr: "60 * * * *", wantErr: true},
+		{name: "day of month out of range", expr: "0 0 0 * *", wantErr: true},
+		{name: "inverted range", expr: "0 17-9 * * *", wantErr: true},
+		{name: "zero step", expr: "*/0 * * * *", wantErr: true},
+		{name: "unknown name", expr: "0 0 * foo *", wantErr: true},
+		{name: "unknown macro", expr: "@fortnightly", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCron(%q) error = %v, wantErr %t", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	at := func(loc *time.Location, year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "next minute",
+			expr: "* * * * *",
+			from: at(time.UTC, 2026, time.January, 1, 10, 0),
+			want: at(time.UTC, 2026, time.January, 1, 10, 1),
+		},
+		{
+			name: "seconds are dropped",
+			expr: "* * * * *",
+			from: at(time.UTC, 2026, time.January, 1, 10, 0).Add(30 * time.Second),
+			want: at(time.UTC, 2026, time.January, 1, 10, 1),
+		},
+		{
+			name: "later today",
+			expr: "30 4 * * *",
+			from: at(time.UTC, 2026, time.January, 1, 1, 0),
+			want: at(time.UTC, 2026, time.January, 1, 4, 30),
+		},
+		{
+			name: "tomorrow",
+			expr: "0 4 * * *",
+			from: at(time.UTC, 2026, time.January, 1, 4, 0),
+			want: at(time.UTC, 2026, time.January, 2, 4, 0),
+		},
+		{
+			name: "day of week",
+			expr: "0 4 * * wed",
+			from: at(time.UTC, 2026, time.January, 1, 0, 0),
+			want: at(time.UTC, 2026, time.January, 7, 4, 0),
+		},
+		{
+			name: "either day field when both are restricted",
+			expr: "0 0 15 * mon",
+			from: at(time.UTC, 2026, time.January, 1, 0, 0),
+			want: at(time.UTC, 2026, time.January, 5, 0, 0),
+		},
+		{
+			name: "next month",
+			expr: "@monthly",
+			from: at(time.UTC, 2026, time.January, 31, 12, 0),
+			want: at(time.UTC, 2026, time.February, 1, 0, 0),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: at(time.UTC, 2026, time.March, 1, 0, 0),
+			want: at(time.UTC, 2028, time.February, 29, 0, 0),
+		},
+		{
+			name: "never matches",
+			expr: "0 0 30 2 *",
+			from: at(time.UTC, 2026, time.January, 1, 0, 0),
+			want: time.Time{},
+		},
+		{
+			name: "half hour offset",
+			expr: "0 11 * * *",
+			from: at(kolkata, 2026, time.January, 1, 10, 5),
+			want: at(kolkata, 2026, time.January, 1, 11, 0),
+		},
+		{
+			name: "spring forward, daily across the gap",
+			expr: "0 4 * * *",
+			from: at(chicago, 2026, time.March, 7, 5, 0),
+			want: at(chicago, 2026, time.March, 8, 4, 0),
+		},
+		{
+			name: "spring forward, skipped hour",
+			expr: "0 2 * * *",
+			from: at(chicago, 2026, time.March, 8, 1, 30),
+			want: at(chicago, 2026, time.March, 9, 2, 0),
+		},
+		{
+			name: "spring forward, weekly",
+			expr: "@weekly",
+			from: at(chicago, 2026, time.March, 8, 1, 30),
+			want: at(chicago, 2026, time.March, 15, 0, 0),
+		},
+		{
+			name: "spring forward, hour after the gap",
+			expr: "0 3 * * *",
+			from: at(chicago, 2026, time.March, 8, 1, 30),
+			want: at(chicago, 2026, time.March, 8, 3, 0),
+		},
+		{
+			name: "fall back, repeated hour",
+			expr: "30 1 * * *",
+			from: at(chicago, 2026, time.November, 1, 0, 0),
+			want: at(chicago, 2026, time.November, 1, 1, 30),
+		},
+		{
+			name: "fall back, hour after the repeat",
+			expr: "0 2 * * *",
+			from: at(chicago, 2026, time.November, 1, 0, 30),
+			want: at(chicago, 2026, time.November, 1, 2, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := cs.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next(%s) for %q = %s, want %s", tt.from, tt.expr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// ReasonDegraded is given for decisions made by the configured degraded decision while a database the policy needs
+// is not loaded
+const ReasonDegraded = "degraded"
+
+var degradedDecisionValues = []string{"", DecisionAllowed, DecisionDenied}
+
+func validateDegradedDecision(decision string) error {
+	for _, v := range degradedDecisionValues {
+		if decision == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid degraded decision %q, must be one of %q", decision, degradedDecisionValues)
+}
+
+// degradedResult translates an EditionNotLoadedError returned while evaluating a policy into the configured
+// fail-open or fail-closed decision.  Without a configured decision, or for any other error, err is returned as-is,
+// which for a missing edition is a 503.  Policies needing a database type no edition is configured for are never
+// degraded, as the edition will never load, and keep their 501.
+func (g *geoman) degradedResult(err error, explain bool) (*LookupDecision, error) {
+	var nle EditionNotLoadedError
+	if g.degradedDecision == "" || !errors.As(err, &nle) {
+		return nil, err
+	}
+
+	var trace *decisionTrace
+	if explain {
+		trace = new(decisionTrace)
+	}
+	trace.add(TraceStep{
+		Rule:         "degraded",
+		Entry:        g.degradedDecision,
+		NormalizedTo: g.degradedDecision,
+		Matched:      true,
+		MatchedType:  "degraded",
+		Detail:       nle.Error(),
+	})
+
+	return &LookupDecision{
+		Decision: g.degradedDecision,
+		Reason:   ReasonDegraded,
+		Matches:  LookupResult{{MatchedType: "degraded", MatchedValue: g.degradedDecision}},
+		Trace:    trace.result(),
+	}, nil
+}
+
+// missingEditions returns the configured editions that have no reader loaded
+func (g *geoman) missingEditions() []string {
+	snap := g.registry.snapshot()
+	out := make([]string, 0)
+	for _, editionID := range snap.editionIDs {
+		if _, err := snap.edition(editionID); err != nil {
+			out = append(out, editionID)
+		}
+	}
+	return out
+}
+
+// recoverEditions tries to load each missing edition, downloading it first when the file is absent or cannot be
+// opened.  The editions that are still missing are returned.
+func (g *geoman) recoverEditions(log zerolog.Logger) []string {
+	for _, editionID := range g.missingEditions() {
+		elog := log.With().Str("edition", editionID).Logger()
+
+		if _, err := os.Stat(g.editionFilepath(editionID)); err == nil {
+			if er, err := openEditionReader(editionID, g.editionFilepath(editionID)); err == nil {
+				g.registry.swap(er)
+				elog.Info().Uint64("build-epoch", er.metadata.BuildEpoch).Msg("Reader loaded")
+				continue
+			} else {
+				elog.Warn().Err(err).Msg("Error opening db, downloading...")
+			}
+		}
+
+		if err := g.download(editionID); err != nil {
+			elog.Error().Err(err).Msg("Error downloading db")
+			continue
+		}
+		g.loadEditions(elog, editionID)
+	}
+
+	return g.missingEditions()
+}
+
+// nextRetry doubles the retry delay, never waiting longer than the maximum retry interval
+func (g *geoman) nextRetry(prev time.Duration) time.Duration {
+	next := prev * 2
+	if next > g.retryMaxInterval {
+		next = g.retryMaxInterval
+	}
+	return next
+}
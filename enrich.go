@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/IncSW/geoip2"
+	"github.com/rs/zerolog"
+)
+
+// enrichDatabaseTypes are the database types an enrichment lookup may consult
+var enrichDatabaseTypes = append(append(append([]string{}, ispDatabaseTypes...), connectionTypeDatabaseTypes...), domainDatabaseTypes...)
+
+type EnrichLookupRequest struct {
+	SourceIP string   `json:"source_ip"`
+	Editions []string `json:"editions,omitempty"`
+}
+
+func (r EnrichLookupRequest) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("source_ip", r.SourceIP)
+	ev.Strs("editions", r.Editions)
+}
+
+type ISPRecord struct {
+	AutonomousSystemNumber       uint32 `json:"autonomous_system_number"`
+	AutonomousSystemOrganization string `json:"autonomous_system_organization"`
+	ISP                          string `json:"isp"`
+	Organization                 string `json:"organization"`
+}
+
+type ConnectionTypeRecord struct {
+	ConnectionType string `json:"connection_type"`
+}
+
+type DomainRecord struct {
+	Domain string `json:"domain"`
+}
+
+type EnrichLookupResult struct {
+	ISP            *ISPRecord            `json:"isp,omitempty"`
+	ConnectionType *ConnectionTypeRecord `json:"connection_type,omitempty"`
+	Domain         *DomainRecord         `json:"domain,omitempty"`
+}
+
+// enrichEditions resolves the requested editions to loaded enrichment readers, defaulting to every loaded
+// enrichment edition
+func enrichEditions(snap *readerSnapshot, requested []string) ([]*editionReader, error) {
+	out := make([]*editionReader, 0)
+
+	if len(requested) == 0 {
+		for _, editionID := range snap.editionIDs {
+			if er, err := snap.edition(editionID); err == nil && er.isType(enrichDatabaseTypes...) {
+				out = append(out, er)
+			}
+		}
+		if len(out) == 0 {
+			if !snap.typeConfigured(enrichDatabaseTypes...) {
+				return nil, readerLookupError(EditionNotConfiguredError{DatabaseTypes: enrichDatabaseTypes})
+			}
+			return nil, readerLookupError(EditionNotLoadedError{DatabaseTypes: enrichDatabaseTypes})
+		}
+		return out, nil
+	}
+
+	for _, editionID := range uniqueStrings(requested) {
+		if !snap.configured(editionID) {
+			return nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Edition %q is not configured in the GeoIP.conf EditionIDs", editionID),
+			}
+		}
+		er, err := snap.edition(editionID)
+		if err != nil {
+			return nil, readerLookupError(err)
+		}
+		if !er.isType(enrichDatabaseTypes...) {
+			return nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Edition %q is a %s database, must be one of %v", editionID, er.metadata.DatabaseType, enrichDatabaseTypes),
+			}
+		}
+		out = append(out, er)
+	}
+
+	return out, nil
+}
+
+func (g *geoman) lookupEnrich(req EnrichLookupRequest) (*EnrichLookupResult, error) {
+	var (
+		ip       net.IP
+		editions []*editionReader
+		err      error
+
+		res = new(EnrichLookupResult)
+	)
+
+	g.log.Info().Object("request", req).Msg("Handling enrich lookup request...")
+
+	if ip, err = parseSourceIP(req.SourceIP); err != nil {
+		return nil, err
+	}
+
+	if editions, err = enrichEditions(g.registry.snapshot(), req.Editions); err != nil {
+		return nil, err
+	}
+
+	// networks absent from an enrichment database are omitted from the result
+	for _, er := range editions {
+		switch reader := er.reader.(type) {
+		case *geoip2.ISPReader:
+			lookup, err := reader.Lookup(ip)
+			if err == geoip2.ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, readerLookupError(err)
+			}
+			res.ISP = &ISPRecord{
+				AutonomousSystemNumber:       lookup.AutonomousSystemNumber,
+				AutonomousSystemOrganization: lookup.AutonomousSystemOrganization,
+				ISP:                          lookup.ISP,
+				Organization:                 lookup.Organization,
+			}
+
+		case *geoip2.ConnectionTypeReader:
+			lookup, err := reader.Lookup(ip)
+			if err == geoip2.ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, readerLookupError(err)
+			}
+			res.ConnectionType = &ConnectionTypeRecord{ConnectionType: lookup}
+
+		case *geoip2.DomainReader:
+			lookup, err := reader.Lookup(ip)
+			if err == geoip2.ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, readerLookupError(err)
+			}
+			res.Domain = &DomainRecord{Domain: lookup}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/IncSW/geoip2"
+)
+
+// fallbackValues are the countries accepted in a fallback chain, tried in the order given
+var fallbackValues = []string{MatchOnLocated, MatchOnRegistered, MatchOnRepresented}
+
+var defaultDecisionValues = []string{DecisionAllowed, DecisionDenied}
+
+func validateFallback(fallback []string, matchOn string) error {
+	if len(fallback) == 0 {
+		return nil
+	}
+	if matchOn != "" && matchOn != MatchOnLocated {
+		return LookupError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("\"fallback\" cannot be combined with a \"match_on\" value of %q", matchOn),
+		}
+	}
+outer:
+	for _, on := range fallback {
+		for _, v := range fallbackValues {
+			if on == v {
+				continue outer
+			}
+		}
+		return LookupError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid \"fallback\" value %q, must be one of %v", on, fallbackValues),
+		}
+	}
+	return nil
+}
+
+func validateDefaultDecision(decision string) error {
+	if decision == "" || decision == DecisionAllowed || decision == DecisionDenied {
+		return nil
+	}
+	return LookupError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("Invalid \"default_decision\" value %q, must be one of %v", decision, defaultDecisionValues),
+	}
+}
+
+// countryChain returns the match_on value of the first country in the policy's fallback chain the database has a
+// record of.  Without a chain only the policy's match_on is tried.  False is returned when none of them are present.
+func countryChain(lookup *geoip2.CountryResult, p Policy, trace *decisionTrace) (string, bool) {
+	chain := p.Fallback
+	if len(chain) == 0 {
+		chain = []string{p.MatchOn}
+	}
+
+	for _, on := range chain {
+		found := len(lookupCountries(lookup, on)) > 0
+		if len(p.Fallback) > 0 {
+			step := TraceStep{Rule: "fallback", ComparedOn: on, Matched: found}
+			if !found {
+				step.Detail = fmt.Sprintf("Source IP has no %s country in the database", on)
+			}
+			trace.add(step)
+		}
+		if found {
+			return on, true
+		}
+	}
+
+	return "", false
+}
+
+// noCountryDecision decides a Source IP for which none of the countries in the policy's chain are known.  The
+// policy's default_decision is used when set, otherwise the Source IP is denied when the policy has allow rules.
+func noCountryDecision(p Policy, reason string, allow LookupResult, trace *decisionTrace) *LookupDecision {
+	if p.DefaultDecision == "" {
+		decision := DecisionDenied
+		if p.Allow.empty() {
+			decision = DecisionAllowed
+		}
+		return &LookupDecision{Decision: decision, Reason: reason, Matches: allow, Trace: trace.result()}
+	}
+
+	trace.add(TraceStep{
+		Rule:         "default_decision",
+		Entry:        p.DefaultDecision,
+		NormalizedTo: p.DefaultDecision,
+		Matched:      true,
+		MatchedType:  "default_decision",
+	})
+
+	return &LookupDecision{
+		Decision: p.DefaultDecision,
+		Reason:   reason,
+		Matches:  LookupResult{{MatchedType: "default_decision", MatchedValue: p.DefaultDecision}},
+		Trace:    trace.result(),
+	}
+}
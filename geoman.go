@@ -2,13 +2,12 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/IncSW/geoip2"
@@ -19,26 +18,87 @@ import (
 )
 
 // todo: support geolite updater config from environment
-// todo: support specific time-of-day sync
-// todo: support asn / city lookup
-// todo: additional context in response?
-// todo: case-insensitive comparisons?
 // todo: break up lookupCountry a bit
 
 type LookupRequest struct {
 	SourceIP           string   `json:"source_ip"`
+	PolicyID           string   `json:"policy_id,omitempty"`
 	MinimumConfidence  *uint16  `json:"minimum_confidence,omitempty"`
-	WhitelistCountries []string `json:"whitelist_countries"`
+	WhitelistCountries []string `json:"whitelist_countries" description:"Country names, ISO codes or GeoNameIDs.  Entries prefixed with \"continent:\" (e.g. \"continent:EU\", \"continent:Europe\") are continent codes or names, all other entries are countries."`
+	WhitelistASNs      []string `json:"whitelist_asns,omitempty"`
+	BlacklistCountries []string `json:"blacklist_countries,omitempty" description:"Same format as whitelist_countries, including \"continent:\" prefixed continent entries."`
+	BlacklistASNs      []string `json:"blacklist_asns,omitempty"`
+	RejectAnonymous    []string `json:"reject_anonymous,omitempty"`
+	MatchOn            string   `json:"match_on,omitempty" description:"Which country of the Source IP country entries are matched against, defaults to \"located\"" enum:"located|registered|represented|any"`
+	Fallback           []string `json:"fallback,omitempty" description:"Countries tried in order when matching country entries, the first one the database knows is used, e.g. [\"located\", \"registered\", \"represented\"]"`
+	DefaultDecision    string   `json:"default_decision,omitempty" description:"Decision for Source IPs the database has no country for, or does not know at all" enum:"allowed|denied"`
+	SpecialAddresses   string   `json:"special_addresses,omitempty" description:"Whether private, loopback, link-local, CGNAT, multicast, documentation and bogon addresses are allowed, defaults to \"deny\"" enum:"allow|deny"`
+	Locale             string   `json:"locale,omitempty" description:"Locale of returned names, e.g. \"de\" or \"pt-BR\".  Defaults to the request's Accept-Language header, falling back to English.  Not accepted by /gipman/lookup."`
+	Explain            bool     `json:"explain,omitempty" description:"Return an ordered trace of every rule evaluated with the decision.  Not accepted by /gipman/lookup."`
+	Include            []string `json:"include,omitempty" description:"Additional context to return with a decision: \"geo\" for the resolved countries, continent and traits, \"database\" for the edition and build the lookup was answered from.  Not accepted by /gipman/lookup."`
 }
 
 func (r LookupRequest) MarshalZerologObject(ev *zerolog.Event) {
 	ev.Str("source_ip", r.SourceIP)
+	ev.Str("policy_id", r.PolicyID)
 	if r.MinimumConfidence == nil {
 		ev.Uint16("minimum_confidence", 0)
 	} else {
 		ev.Uint16("minimum_confidence", *r.MinimumConfidence)
 	}
 	ev.Strs("whitelist_countries", r.WhitelistCountries)
+	ev.Strs("whitelist_asns", r.WhitelistASNs)
+	ev.Strs("blacklist_countries", r.BlacklistCountries)
+	ev.Strs("blacklist_asns", r.BlacklistASNs)
+	ev.Strs("reject_anonymous", r.RejectAnonymous)
+	ev.Str("match_on", r.MatchOn)
+	ev.Strs("fallback", r.Fallback)
+	ev.Str("default_decision", r.DefaultDecision)
+	ev.Str("special_addresses", r.SpecialAddresses)
+	ev.Strs("include", r.Include)
+	ev.Str("locale", r.Locale)
+	ev.Bool("explain", r.Explain)
+}
+
+func (r LookupRequest) evaluateOptions() evaluateOptions {
+	return evaluateOptions{
+		include: r.Include,
+		locale:  r.Locale,
+		explain: r.Explain,
+	}
+}
+
+func (r LookupRequest) hasWhitelist() bool {
+	return len(r.WhitelistCountries) > 0 || len(r.WhitelistASNs) > 0
+}
+
+func (r LookupRequest) hasBlacklist() bool {
+	return len(r.BlacklistCountries) > 0 || len(r.BlacklistASNs) > 0
+}
+
+func (r LookupRequest) hasInlineRules() bool {
+	return r.hasWhitelist() || r.hasBlacklist() || len(r.RejectAnonymous) > 0 || r.MinimumConfidence != nil || r.MatchOn != "" ||
+		len(r.Fallback) > 0 || r.DefaultDecision != "" || r.SpecialAddresses != ""
+}
+
+// inlinePolicy builds an unnamed policy from the whitelist / blacklist fields of the request
+func (r LookupRequest) inlinePolicy() Policy {
+	return Policy{
+		MinimumConfidence: r.MinimumConfidence,
+		RejectAnonymous:   r.RejectAnonymous,
+		MatchOn:           r.MatchOn,
+		Fallback:          r.Fallback,
+		DefaultDecision:   r.DefaultDecision,
+		SpecialAddresses:  r.SpecialAddresses,
+		Allow: PolicyRules{
+			Countries: r.WhitelistCountries,
+			ASNs:      r.WhitelistASNs,
+		},
+		Deny: PolicyRules{
+			Countries: r.BlacklistCountries,
+			ASNs:      r.BlacklistASNs,
+		},
+	}
 }
 
 type LookupMatch struct {
@@ -46,6 +106,9 @@ type LookupMatch struct {
 	MatchedType  string `json:"matched_type"`
 	MatchedValue string `json:"matched_value"`
 	Confidence   uint16 `json:"confidence"`
+	MatchedOn    string `json:"matched_on,omitempty" description:"Which country of the Source IP matched, set for country and continent matches" enum:"located|registered|represented"`
+	Entry        string `json:"entry,omitempty" description:"The country or continent entry of the request that matched, without any \"continent:\" or \"country:\" prefix"`
+	ResolvedTo   string `json:"resolved_to,omitempty" description:"The canonical identifier the entry resolved to: an ISO 3166-1 alpha-2 code, a continent code or a GeoNameID"`
 }
 
 func (r LookupMatch) MarshalZerologObject(ev *zerolog.Event) {
@@ -53,6 +116,9 @@ func (r LookupMatch) MarshalZerologObject(ev *zerolog.Event) {
 	ev.Str("matched_type", r.MatchedType)
 	ev.Str("mathed_value", r.MatchedValue)
 	ev.Uint16("confidence", r.Confidence)
+	ev.Str("matched_on", r.MatchedOn)
+	ev.Str("entry", r.Entry)
+	ev.Str("resolved_to", r.ResolvedTo)
 }
 
 type LookupResult []LookupMatch
@@ -63,6 +129,75 @@ func (r LookupResult) MarshalZerologArray(arr *zerolog.Array) {
 	}
 }
 
+// Values accepted by LookupRequest.MatchOn and Policy.MatchOn.  The located country is where the network is in
+// use, the registered country is where the ISP registered the network and the represented country is the country
+// represented by users of the network, such as military bases or embassies.
+const (
+	MatchOnLocated     = "located"
+	MatchOnRegistered  = "registered"
+	MatchOnRepresented = "represented"
+	MatchOnAny         = "any"
+)
+
+var matchOnValues = []string{MatchOnLocated, MatchOnRegistered, MatchOnRepresented, MatchOnAny}
+
+func validateMatchOn(matchOn string) error {
+	if matchOn == "" {
+		return nil
+	}
+	for _, v := range matchOnValues {
+		if matchOn == v {
+			return nil
+		}
+	}
+	return LookupError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("Invalid \"match_on\" value %q, must be one of %v", matchOn, matchOnValues),
+	}
+}
+
+const (
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+)
+
+// Reasons given for a LookupDecision
+const (
+	ReasonAnonymous    = "anonymous"
+	ReasonDenyMatched  = "deny_matched"
+	ReasonAllowMatched = "allow_matched"
+	ReasonNoAllowMatch = "no_allow_match"
+	ReasonNoDenyMatch  = "no_deny_match"
+	ReasonSpecial      = "special_address"
+	ReasonNotFound     = "not_found"
+	ReasonNoCountry    = "no_country"
+)
+
+// LookupDecision is the outcome of evaluating a LookupRequest.  Blacklist entries take precedence: any blacklist
+// match denies the Source IP and Matches holds the blacklist matches.  Otherwise, when a whitelist is provided the
+// Source IP is allowed only if a whitelist entry matches, with Matches holding the whitelist matches.  A request
+// with only a blacklist allows everything it does not match.  Special addresses, which have no geo data, are
+// decided by the special_addresses setting alone and report their AddressClass.  Source IPs the database does not
+// know, or has none of the fallback countries for, are decided by the default_decision setting.
+type LookupDecision struct {
+	Decision     string        `json:"decision" enum:"allowed|denied"`
+	Reason       string        `json:"reason" enum:"anonymous|deny_matched|allow_matched|no_allow_match|no_deny_match|special_address|not_found|no_country|degraded"`
+	AddressClass string        `json:"address_class,omitempty" enum:"private|loopback|link_local|cgnat|multicast|documentation|bogon"`
+	Matches      LookupResult  `json:"matches"`
+	Geo          *GeoContext   `json:"geo,omitempty"`
+	Database     *DatabaseInfo `json:"database,omitempty"`
+	Trace        []TraceStep   `json:"trace,omitempty"`
+
+	// country is the ISO code of the country the Source IP resolved to, when country rules were evaluated
+	country string
+}
+
+func (d LookupDecision) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("decision", d.Decision)
+	ev.Str("reason", d.Reason)
+	ev.Array("matches", d.Matches)
+}
+
 type LookupError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -79,18 +214,78 @@ func (e LookupError) Error() string {
 	return fmt.Sprintf("code=%d; message=%q; err=%v", e.Code, e.Message, e.Err)
 }
 
+func (e LookupError) Unwrap() error {
+	return e.Err
+}
+
+// readerLookupError translates an error returned while querying the reader registry.  A database type no edition
+// is configured for will never be available, so is a 501, while a configured edition that is not loaded yet is a 503.
+func readerLookupError(err error) error {
+	var (
+		nce EditionNotConfiguredError
+		nle EditionNotLoadedError
+	)
+	if errors.As(err, &nce) {
+		return LookupError{
+			Code:    http.StatusNotImplemented,
+			Message: nce.Error(),
+			Err:     err,
+		}
+	}
+	if errors.As(err, &nle) {
+		return LookupError{
+			Code:    http.StatusServiceUnavailable,
+			Message: nle.Error(),
+			Err:     err,
+		}
+	}
+	if errors.Is(err, geoip2.ErrNotFound) {
+		return LookupError{
+			Code:    http.StatusNotFound,
+			Message: "Source IP was not found in the database",
+			Err:     err,
+		}
+	}
+	return LookupError{
+		Code:    http.StatusInternalServerError,
+		Message: "Error looking up IP",
+		Err:     err,
+	}
+}
+
 type geoman struct {
-	log             zerolog.Logger
-	confFile        string
-	dbDir           string
-	updateInterval  string
-	updateIntervalD time.Duration
+	log            zerolog.Logger
+	confFile       string
+	dbDir          string
+	updateInterval time.Duration
+
+	// missing editions are retried after retryInterval, doubling up to retryMaxInterval
+	retryInterval    time.Duration
+	retryMaxInterval time.Duration
+
+	// updates follow updateCron in updateTimezone when set, otherwise updateInterval, each delayed by up to
+	// updateJitter
+	updateCron     string
+	updateTimezone string
+	updateJitter   time.Duration
+	schedule       *updateSchedule
+	state          *updateState
+
+	// degradedDecision is returned, when set, for lookups made while a database they need is not loaded
+	degradedDecision string
+
+	// readiness requires every edition to answer a lookup of canaryIP and, when set, be built within maxDataAge
+	canaryIP   net.IP
+	maxDataAge time.Duration
 
 	gconfig *geoipupdate.Config
 	gclient *http.Client
 
-	reader   *geoip2.CountryReader
-	readerMu sync.RWMutex
+	registry          readerRegistry
+	policies          policyStore
+	metrics           metrics
+	maxBatchSize      int
+	maxResolveEntries int
 }
 
 func (g *geoman) run(errc chan<- error) {
@@ -100,15 +295,46 @@ func (g *geoman) run(errc chan<- error) {
 
 	g.log.Info().Msg("Starting GeoLite manager...")
 
-	if g.updateIntervalD, err = time.ParseDuration(g.updateInterval); err != nil {
-		errc <- fmt.Errorf("provided update interval value %q is not valid %T: %w", g.updateInterval, g.updateIntervalD, err)
+	if g.updateInterval <= 0 {
+		errc <- fmt.Errorf("provided update interval %s must be positive", g.updateInterval)
+		return
+	}
+
+	if g.schedule, err = newUpdateSchedule(g.updateCron, g.updateTimezone, g.updateInterval, g.updateJitter); err != nil {
+		errc <- err
+		return
+	}
+
+	if g.retryInterval <= 0 {
+		errc <- fmt.Errorf("provided retry interval %s must be positive", g.retryInterval)
+		return
+	}
+
+	if g.retryMaxInterval < g.retryInterval {
+		errc <- fmt.Errorf("provided maximum retry interval %s must be at least the retry interval %s", g.retryMaxInterval, g.retryInterval)
+		return
+	}
+
+	if g.maxBatchSize <= 0 {
+		errc <- fmt.Errorf("provided max batch size %d must be positive", g.maxBatchSize)
+		return
+	}
+
+	if g.maxResolveEntries <= 0 {
+		errc <- fmt.Errorf("provided max resolve entries %d must be positive", g.maxResolveEntries)
+		return
+	}
+
+	if err = validateDegradedDecision(g.degradedDecision); err != nil {
+		errc <- err
 		return
 	}
 
 	g.log.Debug().
 		Str("geolite-conf", g.confFile).
 		Str("geolite-db", g.dbDir).
-		Str("interval", g.updateIntervalD.String()).
+		Str("schedule", g.schedule.String()).
+		Str("jitter", g.updateJitter.String()).
 		Msg("Building updater config")
 
 	if g.gconfig, err = geoipupdate.NewConfig(g.confFile, "", g.dbDir, true); err != nil {
@@ -118,21 +344,37 @@ func (g *geoman) run(errc chan<- error) {
 
 	g.gclient = geoipupdate.NewClient(g.gconfig)
 
+	g.state = newUpdateState(g.gconfig.DatabaseDirectory)
+	if err = g.state.load(); err != nil {
+		g.log.Warn().Err(err).Msg("Update state could not be loaded, databases will be updated now")
+	}
+	for editionID, at := range g.state.Editions {
+		g.metrics.setLastUpdate(editionID, at)
+	}
+
+	// configure editions before the boot downloads so lookups made meanwhile are answered as degraded rather than
+	// as unconfigured
+	g.registry.configure(g.gconfig.EditionIDs)
+
 	g.log.Info().Msg("Checking for db files...")
 	for _, editionID := range g.gconfig.EditionIDs {
 		dbFile := g.editionFilepath(editionID)
 		if _, err := os.Stat(dbFile); err != nil {
 			g.log.Warn().Str("db-file", dbFile).Msg("DB missing on boot, downloading...")
 			if err := g.download(editionID); err != nil {
-				errc <- err
-				return
+				// keep serving in degraded mode, handle retries until the edition loads
+				g.log.Error().Err(err).Str("edition", editionID).Msg("Error downloading db on boot")
 			}
 		}
 	}
 
-	// todo: handle non-country readers.
-	if g.reader, err = g.buildCountryReader(); err != nil {
-		g.log.Error().Err(err).Msg("Error opening db")
+	g.loadEditions(g.log, g.gconfig.EditionIDs...)
+
+	if missing := g.missingEditions(); len(missing) > 0 {
+		g.log.Warn().
+			Strs("editions", missing).
+			Str("degraded-decision", g.degradedDecision).
+			Msg("Starting in degraded mode, lookups needing these editions will not be answered from the database")
 	}
 
 	g.log.Debug().Msg("GeoLite manager initialization completed")
@@ -148,163 +390,513 @@ func (g *geoman) download(editionIDs ...string) error {
 	dbReader := database.NewHTTPDatabaseReader(g.gclient, g.gconfig)
 
 	for _, editionID := range editionIDs {
-		filename, err := geoipupdate.GetFilename(g.gconfig, editionID, g.gclient)
+		err := g.downloadEdition(dbReader, editionID)
+		g.metrics.observeUpdate(editionID, err)
 		if err != nil {
-			return errors.Wrapf(err, "error retrieving filename for %s", editionID)
+			return err
 		}
-		filePath := filepath.Join(g.gconfig.DatabaseDirectory, filename)
-		dbWriter, err := database.NewLocalFileDatabaseWriter(filePath, g.gconfig.LockFile, g.gconfig.Verbose)
-		if err != nil {
-			return errors.Wrapf(err, "error creating database writer for %s", editionID)
-		}
-		if err := dbReader.Get(dbWriter, editionID); err != nil {
-			return errors.WithMessagef(err, "error while getting database for %s", editionID)
+		if err = g.state.record(editionID, time.Now()); err != nil {
+			g.log.Error().Err(err).Str("edition", editionID).Msg("Error recording update")
 		}
 	}
 	return nil
 }
 
-func (g *geoman) buildCountryReader() (*geoip2.CountryReader, error) {
-	return geoip2.NewCountryReaderFromFile(g.editionFilepath("GeoLite2-Country"))
+func (g *geoman) downloadEdition(dbReader database.Reader, editionID string) error {
+	filename, err := geoipupdate.GetFilename(g.gconfig, editionID, g.gclient)
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving filename for %s", editionID)
+	}
+	filePath := filepath.Join(g.gconfig.DatabaseDirectory, filename)
+	dbWriter, err := database.NewLocalFileDatabaseWriter(filePath, g.gconfig.LockFile, g.gconfig.Verbose)
+	if err != nil {
+		return errors.Wrapf(err, "error creating database writer for %s", editionID)
+	}
+	if err := dbReader.Get(dbWriter, editionID); err != nil {
+		return errors.WithMessagef(err, "error while getting database for %s", editionID)
+	}
+	return nil
+}
+
+// loadEditions opens a reader for each edition and swaps it into the registry.  An edition that fails to open
+// keeps serving from its previous reader, if any.
+func (g *geoman) loadEditions(log zerolog.Logger, editionIDs ...string) {
+	for _, editionID := range editionIDs {
+		er, err := openEditionReader(editionID, g.editionFilepath(editionID))
+		if err != nil {
+			log.Error().Err(err).Str("edition", editionID).Msg("Error opening db")
+			continue
+		}
+		g.registry.swap(er)
+		log.Info().
+			Str("edition", editionID).
+			Str("database-type", er.metadata.DatabaseType).
+			Uint64("build-epoch", er.metadata.BuildEpoch).
+			Msg("Reader loaded")
+	}
 }
 
+// nextUpdate returns how long to wait for the next scheduled update.  The schedule continues from the last
+// successful update recorded on disk, so an update missed while gipman was down runs immediately.  A failed
+// attempt waits for the following scheduled time.
+func (g *geoman) nextUpdate(lastAttempt time.Time) time.Duration {
+	last := g.state.lastUpdate(g.gconfig.EditionIDs)
+	if lastAttempt.After(last) {
+		last = lastAttempt
+	}
+
+	due := g.schedule.due(last)
+	wait := g.schedule.wait(due, time.Now())
+
+	if last.IsZero() || wait == 0 {
+		g.log.Info().Time("last-update", last).Msg("Databases are stale, updating now")
+	} else {
+		g.log.Info().Time("last-update", last).Time("next-update", time.Now().Add(wait)).Msg("Next update scheduled")
+	}
+
+	return wait
+}
+
+// handle runs the scheduled updates.  While any edition is missing it also retries loading, and if need be
+// downloading, the missing editions with a backoff starting at the retry interval.
 func (g *geoman) handle() error {
 	var (
-		tmpReader *geoip2.CountryReader
-		err       error
+		err         error
+		lastAttempt time.Time
 
-		updateTimer = time.NewTicker(g.updateIntervalD)
+		updateTimer = time.NewTimer(g.nextUpdate(lastAttempt))
+		retryDelay  = g.retryInterval
+		retryTimer  = time.NewTimer(retryDelay)
 	)
 
 	g.log.Debug().Msg("Entering GeoLite 2 manager handler routine...")
 
-	for range updateTimer.C {
-		log := g.log.With().Str("action", "update").Logger()
-		log.Info().Msg("Running geo ip update...")
-		if err = g.download(g.gconfig.EditionIDs...); err != nil {
-			log.Error().Err(err).Msg("Error updating GeoLite 2 databases!")
-		} else {
-			log.Info().Msg("GeoLite 2 databases updated successfully")
-			if tmpReader, err = g.buildCountryReader(); err != nil {
-				log.Error().Err(err).Msg("Error reconstructing country reader")
+	if len(g.missingEditions()) == 0 {
+		retryTimer.Stop()
+	}
+
+	for {
+		select {
+		case <-updateTimer.C:
+			log := g.log.With().Str("action", "update").Logger()
+			log.Info().Msg("Running geo ip update...")
+			lastAttempt = time.Now()
+			if err = g.download(g.gconfig.EditionIDs...); err != nil {
+				log.Error().Err(err).Msg("Error updating GeoLite 2 databases!")
+			} else {
+				log.Info().Msg("GeoLite 2 databases updated successfully")
+				g.loadEditions(log, g.gconfig.EditionIDs...)
+			}
+			updateTimer.Reset(g.nextUpdate(lastAttempt))
+
+		case <-retryTimer.C:
+			log := g.log.With().Str("action", "retry").Logger()
+			if missing := g.recoverEditions(log); len(missing) > 0 {
+				retryDelay = g.nextRetry(retryDelay)
+				log.Warn().Strs("editions", missing).Str("next-retry", retryDelay.String()).Msg("Still in degraded mode")
+				retryTimer.Reset(retryDelay)
 			} else {
-				log.Info().Msg("Country reader reconstructed")
-				g.readerMu.Lock()
-				g.reader = tmpReader
-				g.readerMu.Unlock()
+				log.Info().Msg("All editions loaded, leaving degraded mode")
+				retryDelay = g.retryInterval
 			}
 		}
-		updateTimer.Reset(g.updateIntervalD)
 	}
-
-	return nil
 }
 
 func uniqueStrings(in []string) []string {
 	if len(in) == 0 {
 		return in
 	}
-	tmp := make(map[string]struct{})
-
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
 	for _, iv := range in {
-		if _, ok := tmp[iv]; !ok {
-			tmp[iv] = struct{}{}
+		if _, ok := seen[iv]; !ok {
+			seen[iv] = struct{}{}
+			out = append(out, iv)
+		}
+	}
+	return out
+}
+
+// writeFileAtomic writes b to a temp file beside filename and renames it into place, so a crash never leaves a
+// partially written file behind
+func writeFileAtomic(filename string, b []byte, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, perm); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// lookupCountryCode returns the ISO code of the located country, falling back to the registered and represented
+// countries
+func lookupCountryCode(lookup *geoip2.CountryResult) string {
+	for _, country := range []geoip2.Country{lookup.Country, lookup.RegisteredCountry, lookup.RepresentedCountry} {
+		if country.ISOCode != "" {
+			return country.ISOCode
 		}
 	}
-	out := make([]string, 0)
-	for k := range tmp {
-		out = append(out, k)
+	return ""
+}
+
+// matchedCountry is one of the country records of a lookup, along with the match_on value it is selected by
+type matchedCountry struct {
+	matchedOn  string
+	country    geoip2.Country
+	confidence uint16
+}
+
+// lookupCountries returns the country records of the lookup selected by matchOn, skipping empty records
+func lookupCountries(lookup *geoip2.CountryResult, matchOn string) []matchedCountry {
+	out := make([]matchedCountry, 0, 3)
+	if matchOn == "" || matchOn == MatchOnLocated || matchOn == MatchOnAny {
+		out = append(out, matchedCountry{MatchOnLocated, lookup.Country, lookup.Country.Confidence})
+	}
+	if matchOn == MatchOnRegistered || matchOn == MatchOnAny {
+		out = append(out, matchedCountry{MatchOnRegistered, lookup.RegisteredCountry, lookup.RegisteredCountry.Confidence})
+	}
+	if matchOn == MatchOnRepresented || matchOn == MatchOnAny {
+		// represented countries carry no confidence of their own
+		out = append(out, matchedCountry{MatchOnRepresented, lookup.RepresentedCountry, lookup.Country.Confidence})
+	}
+	for i := 0; i < len(out); {
+		if out[i].country.GeoNameID == 0 && out[i].country.ISOCode == "" {
+			out = append(out[:i], out[i+1:]...)
+		} else {
+			i++
+		}
 	}
 	return out
 }
 
-func (g *geoman) lookupCountry(req LookupRequest) (LookupResult, error) {
-	g.readerMu.RLock()
-	defer g.readerMu.RUnlock()
+func matchCountry(lookup *geoip2.CountryResult, targets []string, minimumConfidence *uint16, matchOn string, lt listTrace) LookupResult {
+	res := make(LookupResult, 0)
+	entries := make([]countryEntry, 0, len(targets))
 
-	var (
-		ip     net.IP
-		lookup *geoip2.CountryResult
-		err    error
+	for _, target := range uniqueStrings(targets) {
+		entries = append(entries, resolveCountryEntry(target))
+	}
 
-		res = make(LookupResult, 0)
-	)
+	for _, mc := range lookupCountries(lookup, matchOn) {
+		filtered := minimumConfidence != nil && mc.confidence < *minimumConfidence
+
+		for _, ce := range entries {
+			if lt.enabled() {
+				comparedType, comparedAgainst := ce.comparedTo(mc.country)
+				step := TraceStep{
+					Rule:                 "country",
+					Entry:                ce.entry,
+					NormalizedTo:         ce.normalizedTo(),
+					ComparedOn:           mc.matchedOn,
+					ComparedType:         comparedType,
+					ComparedAgainst:      comparedAgainst,
+					FilteredByConfidence: filtered,
+					Confidence:           mc.confidence,
+				}
+				if !filtered {
+					step.MatchedType, _, step.Matched = ce.match(mc.country)
+				}
+				lt.add(step)
+			}
 
-	g.log.Info().Object("request", req).Msg("Handling lookup request...")
+			if filtered {
+				continue
+			}
 
-	if req.SourceIP == "" {
-		return nil, LookupError{
+			matchedType, matchedValue, ok := ce.match(mc.country)
+			if !ok {
+				continue
+			}
+			resolvedTo := ce.resolvedTo()
+			if resolvedTo == "" {
+				resolvedTo = mc.country.ISOCode
+			}
+			res = append(res, LookupMatch{
+				GeoNameID:    mc.country.GeoNameID,
+				MatchedType:  matchedType,
+				MatchedValue: matchedValue,
+				Confidence:   mc.confidence,
+				MatchedOn:    mc.matchedOn,
+				Entry:        ce.entry,
+				ResolvedTo:   resolvedTo,
+			})
+		}
+	}
+
+	return res
+}
+
+// requestPolicy returns the stored policy referenced by the request, or the request's inline policy
+func (g *geoman) requestPolicy(req LookupRequest) (Policy, error) {
+	if req.PolicyID == "" {
+		if !req.hasWhitelist() && !req.hasBlacklist() {
+			return Policy{}, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "\"policy_id\" or at least one of \"whitelist_countries\", \"whitelist_asns\", \"blacklist_countries\" or \"blacklist_asns\" must be provided",
+			}
+		}
+		if err := validateMatchOn(req.MatchOn); err != nil {
+			return Policy{}, err
+		}
+		if err := validateSpecialAddresses(req.SpecialAddresses); err != nil {
+			return Policy{}, err
+		}
+		if err := validateFallback(req.Fallback, req.MatchOn); err != nil {
+			return Policy{}, err
+		}
+		if err := validateDefaultDecision(req.DefaultDecision); err != nil {
+			return Policy{}, err
+		}
+		return req.inlinePolicy(), validateAnonymousFlags(req.RejectAnonymous)
+	}
+
+	if req.hasInlineRules() {
+		return Policy{}, LookupError{
 			Code:    http.StatusBadRequest,
-			Message: "\"source_ip\" must be provided",
+			Message: "\"policy_id\" cannot be combined with whitelist, blacklist, \"reject_anonymous\", \"minimum_confidence\", \"match_on\", \"fallback\", \"default_decision\" or \"special_addresses\" fields",
 		}
 	}
 
-	if len(req.WhitelistCountries) == 0 {
-		return nil, LookupError{
+	p, ok := g.policies.get(req.PolicyID)
+	if !ok {
+		return Policy{}, LookupError{
 			Code:    http.StatusBadRequest,
-			Message: "\"whitelist_countries\" must have at least one entry",
+			Message: fmt.Sprintf("Unknown \"policy_id\" %q", req.PolicyID),
 		}
 	}
 
-	if ip = net.ParseIP(req.SourceIP); ip == nil {
+	return p, nil
+}
+
+// evaluateOptions are the per-request settings of an evaluation that are not part of the policy
+type evaluateOptions struct {
+	include []string
+	locale  string
+	explain bool
+
+	// optionalContext omits context, rather than failing, when no edition it could come from is loaded
+	optionalContext bool
+}
+
+// evaluateWithContext evaluates the policy, adding any requested context to the decision
+func (g *geoman) evaluateWithContext(snap *readerSnapshot, sourceIP string, p Policy, opts evaluateOptions) (*LookupDecision, error) {
+	if err := validateInclude(opts.include); err != nil {
+		return nil, err
+	}
+
+	dec, err := g.evaluate(snap, sourceIP, p, opts.explain)
+	if err != nil {
+		return nil, err
+	}
+
+	// degraded decisions are made without the database, so have no context to include
+	if dec.Reason == ReasonDegraded {
+		return dec, nil
+	}
+
+	if err = includeContext(dec, snap, sourceIP, opts.include, opts.locale); err != nil {
+		var (
+			nce EditionNotConfiguredError
+			nle EditionNotLoadedError
+		)
+		if opts.optionalContext && (errors.As(err, &nce) || errors.As(err, &nle)) {
+			return dec, nil
+		}
+		return nil, err
+	}
+
+	return dec, nil
+}
+
+// evaluate applies a policy to the Source IP using the readers in snap.  When explain is set the decision carries
+// a trace of every rule evaluated.  Policies needing an edition that is not loaded get the degraded decision.
+func (g *geoman) evaluate(snap *readerSnapshot, sourceIP string, p Policy, explain bool) (*LookupDecision, error) {
+	dec, err := g.evaluatePolicy(snap, sourceIP, p, explain)
+	if err != nil {
+		dec, err = g.degradedResult(err, explain)
+	}
+	g.metrics.observeLookup(dec, err)
+	return dec, err
+}
+
+func (g *geoman) evaluatePolicy(snap *readerSnapshot, sourceIP string, p Policy, explain bool) (dec *LookupDecision, err error) {
+	var (
+		ip        net.IP
+		lookup    *geoip2.CountryResult
+		asnReader *geoip2.ASNReader
+		asnLookup *geoip2.ASN
+		anonymous AnonymousIPLookupResult
+		trace     *decisionTrace
+		noCountry string
+
+		allow = make(LookupResult, 0)
+		deny  = make(LookupResult, 0)
+	)
+
+	defer func() {
+		if dec != nil && lookup != nil {
+			dec.country = lookupCountryCode(lookup)
+		}
+	}()
+
+	if explain {
+		trace = new(decisionTrace)
+	}
+
+	if sourceIP == "" {
 		return nil, LookupError{
 			Code:    http.StatusBadRequest,
-			Message: "Invalid \"source_ip\" value provided",
+			Message: "\"source_ip\" must be provided",
 		}
 	}
 
-	if lookup, err = g.reader.Lookup(ip); err != nil {
+	if ip = net.ParseIP(sourceIP); ip == nil {
 		return nil, LookupError{
-			Code:    http.StatusInternalServerError,
-			Message: "Error looking up IP",
-			Err:     err,
+			Code:    http.StatusBadRequest,
+			Message: "Invalid \"source_ip\" value provided",
 		}
 	}
 
-	g.log.Debug().Interface("matched", lookup.Country).Msg("match result")
+	allow = append(allow, matchCIDR(ip, p.Allow.CIDRs, trace.list("allow"))...)
+	deny = append(deny, matchCIDR(ip, p.Deny.CIDRs, trace.list("deny"))...)
 
-	for _, target := range uniqueStrings(req.WhitelistCountries) {
-		var (
-			asUint uint64
-			err    error
+	// special addresses are never in the databases, so only cidr rules are applied to them
+	if class := addressClass(ip); class != "" {
+		return specialDecision(p, class, allow, deny, trace), nil
+	}
 
-			lt = strings.ToLower(target)
-		)
-		if req.MinimumConfidence != nil && lookup.Country.Confidence < *req.MinimumConfidence {
-			continue
+	if len(p.RejectAnonymous) > 0 {
+		if anonymous, err = anonymousIPLookup(snap, ip); err != nil {
+			return nil, err
+		}
+
+		for _, flag := range p.RejectAnonymous {
+			trace.list("deny").add(TraceStep{
+				Rule:            "anonymous",
+				Entry:           flag,
+				ComparedType:    "anonymous_flags",
+				ComparedAgainst: strings.Join(anonymous.Flags(), ","),
+				Matched:         len(rejectedAnonymousFlags(anonymous, []string{flag})) > 0,
+			})
 		}
 
-		for _, cname := range lookup.Country.Names {
-			if strings.ToLower(cname) == lt {
-				res = append(res, LookupMatch{
-					GeoNameID:    lookup.Country.GeoNameID,
-					MatchedType:  "country_name",
-					MatchedValue: cname,
-					Confidence:   lookup.Country.Confidence,
-				})
+		if rejected := rejectedAnonymousFlags(anonymous, p.RejectAnonymous); len(rejected) > 0 {
+			g.log.Info().Object("anonymous", anonymous).Strs("rejected", rejected).Msg("Source IP rejected as anonymous")
+			for _, flag := range rejected {
+				deny = append(deny, LookupMatch{MatchedType: "anonymous", MatchedValue: flag})
 			}
+			return &LookupDecision{Decision: DecisionDenied, Reason: ReasonAnonymous, Matches: deny, Trace: trace.result()}, nil
 		}
+	}
 
-		if lookup.Country.ISOCode == target {
-			res = append(res, LookupMatch{
-				GeoNameID:    lookup.Country.GeoNameID,
-				MatchedType:  "iso_code",
-				MatchedValue: lookup.Country.ISOCode,
-				Confidence:   lookup.Country.Confidence,
-			})
+	if p.Allow.needsCountry() || p.Deny.needsCountry() {
+		if lookup, err = snap.countryLookup(ip); err == geoip2.ErrNotFound {
+			trace.add(TraceStep{Rule: "fallback", Detail: "Source IP is not in the country database"})
+			noCountry = ReasonNotFound
+		} else if err != nil {
+			return nil, readerLookupError(err)
+		} else if matchOn, ok := countryChain(lookup, p, trace); !ok {
+			noCountry = ReasonNoCountry
+		} else {
+			g.log.Debug().Interface("matched", lookup.Country).Str("match_on", matchOn).Msg("match result")
+
+			allowCountries, allowContinents := splitCountryEntries(p.Allow.Countries)
+			denyCountries, denyContinents := splitCountryEntries(p.Deny.Countries)
+
+			allow = append(allow, matchCountry(lookup, allowCountries, p.MinimumConfidence, matchOn, trace.list("allow"))...)
+			allow = append(allow, matchContinent(lookup, append(allowContinents, p.Allow.Continents...), p.MinimumConfidence, matchOn, trace.list("allow"))...)
+			deny = append(deny, matchCountry(lookup, denyCountries, p.MinimumConfidence, matchOn, trace.list("deny"))...)
+			deny = append(deny, matchContinent(lookup, append(denyContinents, p.Deny.Continents...), p.MinimumConfidence, matchOn, trace.list("deny"))...)
 		}
+	}
+
+	if len(p.Allow.ASNs) > 0 || len(p.Deny.ASNs) > 0 {
+		if asnReader, err = snap.asn(); err != nil {
+			return nil, readerLookupError(err)
+		}
+
+		// networks absent from the asn database simply match no asn entries
+		if asnLookup, err = asnReader.Lookup(ip); err == nil {
+			g.log.Debug().Interface("matched", asnLookup).Msg("asn match result")
 
-		if asUint, err = strconv.ParseUint(target, 10, 32); err == nil {
-			if lookup.Country.GeoNameID == uint32(asUint) {
-				res = append(res, LookupMatch{
-					GeoNameID:    lookup.Country.GeoNameID,
-					MatchedType:  "geo_name_id",
-					MatchedValue: target,
-					Confidence:   lookup.Country.Confidence,
-				})
+			allow = append(allow, matchASN(asnLookup, p.Allow.ASNs, trace.list("allow"))...)
+			deny = append(deny, matchASN(asnLookup, p.Deny.ASNs, trace.list("deny"))...)
+		} else if err == geoip2.ErrNotFound {
+			for _, target := range uniqueStrings(p.Allow.ASNs) {
+				trace.list("allow").add(TraceStep{Rule: "asn", Entry: target, Detail: "Source IP is not in the asn database"})
 			}
+			for _, target := range uniqueStrings(p.Deny.ASNs) {
+				trace.list("deny").add(TraceStep{Rule: "asn", Entry: target, Detail: "Source IP is not in the asn database"})
+			}
+		} else {
+			return nil, readerLookupError(err)
 		}
 	}
 
-	return res, nil
+	if len(deny) > 0 {
+		return &LookupDecision{Decision: DecisionDenied, Reason: ReasonDenyMatched, Matches: deny, Trace: trace.result()}, nil
+	}
+
+	// country rules could not be evaluated, so only a cidr or asn allow match decides the Source IP
+	if noCountry != "" && len(allow) == 0 {
+		return noCountryDecision(p, noCountry, allow, trace), nil
+	}
+
+	if p.Allow.empty() {
+		return &LookupDecision{Decision: DecisionAllowed, Reason: ReasonNoDenyMatch, Matches: allow, Trace: trace.result()}, nil
+	}
+
+	if len(allow) == 0 {
+		return &LookupDecision{Decision: DecisionDenied, Reason: ReasonNoAllowMatch, Matches: allow, Trace: trace.result()}, nil
+	}
+
+	return &LookupDecision{Decision: DecisionAllowed, Reason: ReasonAllowMatched, Matches: allow, Trace: trace.result()}, nil
+}
+
+// lookupCountry retains the original lookup contract, where a non-empty result means the Source IP is allowed
+func (g *geoman) lookupCountry(req LookupRequest) (LookupResult, error) {
+	g.log.Info().Object("request", req).Msg("Handling lookup request...")
+
+	// a lookup result is only the matches, so has nowhere to put a trace, context or localized names
+	if req.Explain || len(req.Include) > 0 || req.Locale != "" {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "\"explain\", \"include\" and \"locale\" are not supported by lookups, use /gipman/v2/lookup",
+		}
+	}
+
+	p, err := g.requestPolicy(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Allow.empty() {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "The lookup must have at least one whitelist or allow entry, use /gipman/v2/lookup for blacklist-only requests",
+		}
+	}
+
+	dec, err := g.evaluate(g.registry.snapshot(), req.SourceIP, p, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if dec.Reason == ReasonNotFound && p.DefaultDecision == "" {
+		return nil, LookupError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("Source IP %s was not found in the database", req.SourceIP),
+		}
+	}
+
+	if dec.Decision == DecisionDenied {
+		return make(LookupResult, 0), nil
+	}
+
+	return dec.Matches, nil
 }
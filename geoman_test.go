@@ -0,0 +1,460 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// encodeTestMMDBControl writes the control byte of a MaxMind DB value, sizes up to 284 are supported
+func encodeTestMMDBControl(typ byte, size int) []byte {
+	var out []byte
+	if size < 29 {
+		out = []byte{byte(size)}
+	} else {
+		out = []byte{29, byte(size - 29)}
+	}
+	if typ <= mmdbTypeMap {
+		out[0] |= typ << 5
+		return out
+	}
+	return append([]byte{out[0]}, append([]byte{typ - 7}, out[1:]...)...)
+}
+
+func encodeTestMMDBUint(typ byte, v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return append(encodeTestMMDBControl(typ, len(b)), b...)
+}
+
+// encodeTestMMDB encodes v in the MaxMind DB data format.  Map keys are written in sorted order.
+func encodeTestMMDB(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return append(encodeTestMMDBControl(mmdbTypeString, len(v)), v...)
+	case uint16:
+		return encodeTestMMDBUint(mmdbTypeUint16, uint64(v))
+	case uint32:
+		return encodeTestMMDBUint(mmdbTypeUint32, uint64(v))
+	case uint64:
+		return encodeTestMMDBUint(mmdbTypeUint64, v)
+	case bool:
+		if v {
+			return encodeTestMMDBControl(mmdbTypeBool, 1)
+		}
+		return encodeTestMMDBControl(mmdbTypeBool, 0)
+	case []string:
+		out := encodeTestMMDBControl(mmdbTypeSlice, len(v))
+		for _, s := range v {
+			out = append(out, encodeTestMMDB(s)...)
+		}
+		return out
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return encodeTestMMDB(m)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := encodeTestMMDBControl(mmdbTypeMap, len(v))
+		for _, k := range keys {
+			out = append(out, encodeTestMMDB(k)...)
+			out = append(out, encodeTestMMDB(v[k])...)
+		}
+		return out
+	default:
+		panic("unsupported test mmdb value")
+	}
+}
+
+type testNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// buildTestMMDB builds an IPv4 MaxMind DB of 24 bit records holding each network's record
+func buildTestMMDB(t *testing.T, dbType string, networks []testNetwork) []byte {
+	t.Helper()
+
+	// records hold a node index, -1 for no data, or -2-offset for an offset into the data section
+	var (
+		nodes = [][2]int{{-1, -1}}
+		data  []byte
+	)
+
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatalf("invalid test network %q: %v", n.cidr, err)
+		}
+		ip := ipNet.IP.To4()
+		ones, _ := ipNet.Mask.Size()
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = -2 - len(data)
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+		data = append(data, encodeTestMMDB(n.record)...)
+	}
+
+	var buf []byte
+	for _, node := range nodes {
+		for _, record := range node {
+			v := record
+			if record == -1 {
+				v = len(nodes)
+			} else if record < -1 {
+				v = len(nodes) + 16 + (-2 - record)
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, data...)
+	buf = append(buf, mmdbMetadataStartMarker...)
+	buf = append(buf, encodeTestMMDB(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1600000000),
+		"database_type":               dbType,
+		"description":                 map[string]string{"en": "test"},
+		"ip_version":                  uint16(4),
+		"languages":                   []string{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})...)
+
+	return buf
+}
+
+func testCountry(geoNameID uint32, isoCode, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"geoname_id": geoNameID,
+		"iso_code":   isoCode,
+		"names":      map[string]string{"en": name},
+	}
+}
+
+var (
+	testCountryNetworks = []testNetwork{
+		{"8.0.0.0/8", map[string]interface{}{
+			"continent":          map[string]interface{}{"code": "NA", "geoname_id": uint32(6255149), "names": map[string]string{"en": "North America"}},
+			"country":            testCountry(6252001, "US", "United States"),
+			"registered_country": testCountry(6252001, "US", "United States"),
+		}},
+		{"2.0.0.0/8", map[string]interface{}{
+			"continent":          map[string]interface{}{"code": "EU", "geoname_id": uint32(6255148), "names": map[string]string{"en": "Europe"}},
+			"country":            testCountry(2921044, "DE", "Germany"),
+			"registered_country": testCountry(2921044, "DE", "Germany"),
+		}},
+		// known only by the country its network is registered in
+		{"5.0.0.0/8", map[string]interface{}{
+			"registered_country": testCountry(3017382, "FR", "France"),
+		}},
+	}
+	testASNNetworks = []testNetwork{
+		{"8.0.0.0/8", map[string]interface{}{
+			"autonomous_system_number":       uint32(15169),
+			"autonomous_system_organization": "GOOGLE",
+		}},
+	}
+)
+
+// newTestGeoman configures every edition in editionIDs, loading those given in editions
+func newTestGeoman(t *testing.T, editionIDs []string, editions map[string][]byte) *geoman {
+	t.Helper()
+
+	g := &geoman{log: zerolog.Nop()}
+	g.registry.configure(editionIDs)
+
+	dir := t.TempDir()
+	for editionID, buf := range editions {
+		filename := filepath.Join(dir, editionID+".mmdb")
+		if err := ioutil.WriteFile(filename, buf, 0644); err != nil {
+			t.Fatalf("error writing %s: %v", editionID, err)
+		}
+		er, err := openEditionReader(editionID, filename)
+		if err != nil {
+			t.Fatalf("openEditionReader(%s) error = %v", editionID, err)
+		}
+		g.registry.swap(er)
+	}
+
+	return g
+}
+
+func TestGeomanEvaluate(t *testing.T) {
+	countryDB := buildTestMMDB(t, "GeoLite2-Country", testCountryNetworks)
+	asnDB := buildTestMMDB(t, "GeoLite2-ASN", testASNNetworks)
+
+	countryOnly := map[string][]byte{"GeoLite2-Country": countryDB}
+	countryAndASN := map[string][]byte{"GeoLite2-Country": countryDB, "GeoLite2-ASN": asnDB}
+
+	tests := []struct {
+		name       string
+		editionIDs []string
+		editions   map[string][]byte
+		degraded   string
+		sourceIP   string
+		policy     Policy
+		want       string
+		wantReason string
+		wantCode   int
+	}{
+		{
+			name:       "allow match",
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"US"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonAllowMatched,
+		},
+		{
+			name:       "no allow match",
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"Germany"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonNoAllowMatch,
+		},
+		{
+			name:       "deny match",
+			sourceIP:   "2.2.2.2",
+			policy:     Policy{Deny: PolicyRules{Countries: []string{"DEU"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonDenyMatched,
+		},
+		{
+			name:       "no deny match",
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Deny: PolicyRules{Countries: []string{"DE"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonNoDenyMatch,
+		},
+		{
+			name:       "deny takes precedence over allow",
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"US"}}, Deny: PolicyRules{Continents: []string{"NA"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonDenyMatched,
+		},
+		{
+			name:       "continent allow match",
+			sourceIP:   "2.2.2.2",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"continent:Europe"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonAllowMatched,
+		},
+		{
+			name:       "not found",
+			sourceIP:   "9.9.9.9",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"US"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonNotFound,
+		},
+		{
+			name:       "not found deny only",
+			sourceIP:   "9.9.9.9",
+			policy:     Policy{Deny: PolicyRules{Countries: []string{"US"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonNotFound,
+		},
+		{
+			name:       "not found default decision",
+			sourceIP:   "9.9.9.9",
+			policy:     Policy{DefaultDecision: DecisionAllowed, Allow: PolicyRules{Countries: []string{"US"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonNotFound,
+		},
+		{
+			name:       "not found cidr allow match",
+			sourceIP:   "9.9.9.9",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"US"}, CIDRs: []string{"9.0.0.0/8"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonAllowMatched,
+		},
+		{
+			name:       "no located country",
+			sourceIP:   "5.5.5.5",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"FR"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonNoCountry,
+		},
+		{
+			name:       "no country default decision",
+			sourceIP:   "5.5.5.5",
+			policy:     Policy{DefaultDecision: DecisionAllowed, Deny: PolicyRules{Countries: []string{"FR"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonNoCountry,
+		},
+		{
+			name:       "fallback to registered country",
+			sourceIP:   "5.5.5.5",
+			policy:     Policy{Fallback: []string{MatchOnLocated, MatchOnRegistered}, Allow: PolicyRules{Countries: []string{"FR"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonAllowMatched,
+		},
+		{
+			name:       "special address",
+			sourceIP:   "10.0.0.1",
+			policy:     Policy{Deny: PolicyRules{Countries: []string{"US"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonSpecial,
+		},
+		{
+			name:       "special address allowed",
+			sourceIP:   "10.0.0.1",
+			policy:     Policy{SpecialAddresses: SpecialAddressesAllow, Allow: PolicyRules{Countries: []string{"US"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonSpecial,
+		},
+		{
+			name:       "asn deny match",
+			editions:   countryAndASN,
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Allow: PolicyRules{Countries: []string{"US"}}, Deny: PolicyRules{ASNs: []string{"AS15169"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonDenyMatched,
+		},
+		{
+			name:       "edition not loaded",
+			editionIDs: []string{"GeoLite2-Country", "GeoLite2-ASN"},
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Deny: PolicyRules{ASNs: []string{"15169"}}},
+			wantCode:   http.StatusServiceUnavailable,
+		},
+		{
+			name:       "edition not loaded fails open",
+			editionIDs: []string{"GeoLite2-Country", "GeoLite2-ASN"},
+			degraded:   DecisionAllowed,
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Deny: PolicyRules{ASNs: []string{"15169"}}},
+			want:       DecisionAllowed,
+			wantReason: ReasonDegraded,
+		},
+		{
+			name:       "edition not loaded fails closed",
+			editionIDs: []string{"GeoLite2-Country", "GeoLite2-ASN"},
+			degraded:   DecisionDenied,
+			sourceIP:   "8.8.8.8",
+			policy:     Policy{Allow: PolicyRules{ASNs: []string{"15169"}}},
+			want:       DecisionDenied,
+			wantReason: ReasonDegraded,
+		},
+		{
+			name:     "edition not configured is never degraded",
+			degraded: DecisionAllowed,
+			sourceIP: "8.8.8.8",
+			policy:   Policy{Deny: PolicyRules{ASNs: []string{"15169"}}},
+			wantCode: http.StatusNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editions := tt.editions
+			if editions == nil {
+				editions = countryOnly
+			}
+			editionIDs := tt.editionIDs
+			if editionIDs == nil {
+				for editionID := range editions {
+					editionIDs = append(editionIDs, editionID)
+				}
+				sort.Strings(editionIDs)
+			}
+
+			g := newTestGeoman(t, editionIDs, editions)
+			g.degradedDecision = tt.degraded
+
+			dec, err := g.evaluate(g.registry.snapshot(), tt.sourceIP, tt.policy, false)
+			if tt.wantCode != 0 {
+				var lerr LookupError
+				if !errors.As(err, &lerr) || lerr.Code != tt.wantCode {
+					t.Fatalf("evaluate() error = %v, want code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if dec.Decision != tt.want || dec.Reason != tt.wantReason {
+				t.Errorf("evaluate() = %s / %s, want %s / %s", dec.Decision, dec.Reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestGeomanEvaluateTraceOrder(t *testing.T) {
+	g := newTestGeoman(t, []string{"GeoLite2-Country"}, map[string][]byte{
+		"GeoLite2-Country": buildTestMMDB(t, "GeoLite2-Country", testCountryNetworks),
+	})
+
+	policy := Policy{Allow: PolicyRules{Countries: []string{"France", "DE", "continent:EU", "US", "DE", "JP"}}}
+	want := []string{"country:France", "country:DE", "country:US", "country:JP", "continent:EU"}
+
+	// repeat the evaluation, a trace built from map iteration would not keep the same order every time
+	for i := 0; i < 20; i++ {
+		dec, err := g.evaluate(g.registry.snapshot(), "8.8.8.8", policy, true)
+		if err != nil {
+			t.Fatalf("evaluate() error = %v", err)
+		}
+		var got []string
+		for _, step := range dec.Trace {
+			got = append(got, step.Rule+":"+step.Entry)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("evaluate() trace = %v, want %v", got, want)
+		}
+		for j, step := range dec.Trace {
+			if step.Step != j+1 {
+				t.Fatalf("evaluate() trace step %d numbered %d", j+1, step.Step)
+			}
+		}
+	}
+}
+
+func TestUniqueStrings(t *testing.T) {
+	got := uniqueStrings([]string{"b", "a", "b", "c", "a"})
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueStrings() = %v, want %v", got, want)
+	}
+}
+
+func TestGeomanEvaluateMatchedTypeLabel(t *testing.T) {
+	g := newTestGeoman(t, []string{"GeoLite2-Country"}, map[string][]byte{
+		"GeoLite2-Country": buildTestMMDB(t, "GeoLite2-Country", testCountryNetworks),
+	})
+
+	// cidr rules are evaluated before country rules, so label the lookup with the cidr match
+	policy := Policy{Allow: PolicyRules{Countries: []string{"US"}, CIDRs: []string{"8.0.0.0/8"}}}
+	if _, err := g.evaluate(g.registry.snapshot(), "8.8.8.8", policy, false); err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+
+	want := lookupKey{outcome: DecisionAllowed, matchedType: "cidr", country: "US"}
+	if got := g.metrics.snapshot().lookups; got[want] != 1 || len(got) != 1 {
+		t.Errorf("lookups = %v, want %v counted once", got, want)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/dcarbone/gipman
 
-go 1.15
+go 1.21
 
 require (
 	facette.io/natsort v0.0.0-20181210072756-2cd4dd1e2dcb
@@ -12,4 +12,20 @@ require (
 	github.com/maxmind/geoipupdate/v4 v4.3.0
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.19.0
+	golang.org/x/text v0.3.3
+)
+
+require (
+	github.com/PuerkitoBio/purell v1.1.1 // indirect
+	github.com/PuerkitoBio/urlesc v0.0.0-20170810143723-de5bf2ad4578 // indirect
+	github.com/go-openapi/jsonpointer v0.19.3 // indirect
+	github.com/go-openapi/jsonreference v0.19.4 // indirect
+	github.com/go-openapi/swag v0.19.6 // indirect
+	github.com/gofrs/flock v0.7.1 // indirect
+	github.com/json-iterator/go v1.1.8 // indirect
+	github.com/mailru/easyjson v0.0.0-20190626092158-b2ccc519800e // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v0.0.0-20180701023420-4b7aa43c6742 // indirect
+	golang.org/x/net v0.0.0-20190827160401-ba9fcec4b297 // indirect
+	gopkg.in/yaml.v2 v2.2.7 // indirect
 )
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/IncSW/geoip2"
+)
+
+// Canary results reported for each edition by readyz
+const (
+	CanaryOK      = "ok"
+	CanaryFailed  = "failed"
+	CanarySkipped = "skipped"
+)
+
+type HealthResult struct {
+	Status string `json:"status"`
+}
+
+// EditionReadiness is the state of a single configured edition.  Build and load details are only set once the
+// edition is loaded.
+type EditionReadiness struct {
+	EditionID    string     `json:"edition_id"`
+	Ready        bool       `json:"ready"`
+	Loaded       bool       `json:"loaded"`
+	DatabaseType string     `json:"database_type,omitempty"`
+	BuildEpoch   uint64     `json:"build_epoch,omitempty"`
+	BuildTime    *time.Time `json:"build_time,omitempty"`
+	LoadedAt     *time.Time `json:"loaded_at,omitempty"`
+	DataAge      string     `json:"data_age,omitempty" description:"Time since the database was built"`
+	Canary       string     `json:"canary" enum:"ok|failed|skipped"`
+	Reason       string     `json:"reason,omitempty"`
+}
+
+// ReadinessResult is ready only once every configured edition is loaded, answers the canary lookup and, when a
+// maximum data age is configured, was built within it
+type ReadinessResult struct {
+	Ready      bool               `json:"ready"`
+	CanaryIP   string             `json:"canary_ip"`
+	MaxDataAge string             `json:"max_data_age,omitempty"`
+	Editions   []EditionReadiness `json:"editions"`
+}
+
+// canaryLookup looks the canary IP up in the edition.  Country and city editions must know the canary, other
+// editions only cover some networks so need only answer without error.
+func canaryLookup(er *editionReader, ip net.IP) error {
+	var err error
+
+	switch reader := er.reader.(type) {
+	case *geoip2.CountryReader:
+		_, err = reader.Lookup(ip)
+		return err
+	case *geoip2.CityReader:
+		_, err = reader.Lookup(ip)
+		return err
+	case *geoip2.ASNReader:
+		_, err = reader.Lookup(ip)
+	case *geoip2.AnonymousIPReader:
+		_, err = reader.Lookup(ip)
+	case *geoip2.ISPReader:
+		_, err = reader.Lookup(ip)
+	case *geoip2.ConnectionTypeReader:
+		_, err = reader.Lookup(ip)
+	case *geoip2.DomainReader:
+		_, err = reader.Lookup(ip)
+	default:
+		return fmt.Errorf("edition %s has no reader", er.editionID)
+	}
+
+	if err == geoip2.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (g *geoman) health() HealthResult {
+	return HealthResult{Status: "ok"}
+}
+
+func (g *geoman) readiness() ReadinessResult {
+	var (
+		now  = time.Now()
+		snap = g.registry.snapshot()
+
+		res = ReadinessResult{
+			Ready:    len(snap.editionIDs) > 0,
+			CanaryIP: g.canaryIP.String(),
+			Editions: make([]EditionReadiness, 0, len(snap.editionIDs)),
+		}
+	)
+
+	if g.maxDataAge > 0 {
+		res.MaxDataAge = g.maxDataAge.String()
+	}
+
+	for _, editionID := range snap.editionIDs {
+		state := EditionReadiness{EditionID: editionID, Canary: CanarySkipped}
+
+		er, err := snap.edition(editionID)
+		if err != nil {
+			state.Reason = err.Error()
+			res.Ready = false
+			res.Editions = append(res.Editions, state)
+			continue
+		}
+
+		buildTime := time.Unix(int64(er.metadata.BuildEpoch), 0).UTC()
+		loadedAt := er.loadedAt
+		state.Loaded = true
+		state.DatabaseType = er.metadata.DatabaseType
+		state.BuildEpoch = er.metadata.BuildEpoch
+		state.BuildTime = &buildTime
+		state.LoadedAt = &loadedAt
+		state.DataAge = now.Sub(buildTime).Truncate(time.Second).String()
+
+		if err = canaryLookup(er, g.canaryIP); err != nil {
+			state.Canary = CanaryFailed
+			state.Reason = fmt.Sprintf("canary lookup of %s failed: %v", g.canaryIP, err)
+		} else {
+			state.Canary = CanaryOK
+			if g.maxDataAge > 0 && now.Sub(buildTime) > g.maxDataAge {
+				state.Reason = fmt.Sprintf("data is older than %s", g.maxDataAge)
+			} else {
+				state.Ready = true
+			}
+		}
+
+		res.Ready = res.Ready && state.Ready
+		res.Editions = append(res.Editions, state)
+	}
+
+	return res
+}
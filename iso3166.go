@@ -0,0 +1,262 @@
+package main
+
+// iso3166Country is an ISO 3166-1 country with its alpha-2, alpha-3 and numeric codes, and its short, common and
+// official English names
+type iso3166Country struct {
+	alpha2  string
+	alpha3  string
+	numeric string
+	names   []string
+}
+
+var iso3166Countries = []iso3166Country{
+	{"AD", "AND", "020", []string{"Andorra", "Principality of Andorra"}},
+	{"AE", "ARE", "784", []string{"United Arab Emirates"}},
+	{"AF", "AFG", "004", []string{"Afghanistan", "Islamic Republic of Afghanistan"}},
+	{"AG", "ATG", "028", []string{"Antigua and Barbuda"}},
+	{"AI", "AIA", "660", []string{"Anguilla"}},
+	{"AL", "ALB", "008", []string{"Albania", "Republic of Albania"}},
+	{"AM", "ARM", "051", []string{"Armenia", "Republic of Armenia"}},
+	{"AO", "AGO", "024", []string{"Angola", "Republic of Angola"}},
+	{"AQ", "ATA", "010", []string{"Antarctica"}},
+	{"AR", "ARG", "032", []string{"Argentina", "Argentine Republic"}},
+	{"AS", "ASM", "016", []string{"American Samoa"}},
+	{"AT", "AUT", "040", []string{"Austria", "Republic of Austria"}},
+	{"AU", "AUS", "036", []string{"Australia"}},
+	{"AW", "ABW", "533", []string{"Aruba"}},
+	{"AX", "ALA", "248", []string{"Åland Islands"}},
+	{"AZ", "AZE", "031", []string{"Azerbaijan", "Republic of Azerbaijan"}},
+	{"BA", "BIH", "070", []string{"Bosnia and Herzegovina", "Republic of Bosnia and Herzegovina"}},
+	{"BB", "BRB", "052", []string{"Barbados"}},
+	{"BD", "BGD", "050", []string{"Bangladesh", "People's Republic of Bangladesh"}},
+	{"BE", "BEL", "056", []string{"Belgium", "Kingdom of Belgium"}},
+	{"BF", "BFA", "854", []string{"Burkina Faso"}},
+	{"BG", "BGR", "100", []string{"Bulgaria", "Republic of Bulgaria"}},
+	{"BH", "BHR", "048", []string{"Bahrain", "Kingdom of Bahrain"}},
+	{"BI", "BDI", "108", []string{"Burundi", "Republic of Burundi"}},
+	{"BJ", "BEN", "204", []string{"Benin", "Republic of Benin"}},
+	{"BL", "BLM", "652", []string{"Saint Barthélemy"}},
+	{"BM", "BMU", "060", []string{"Bermuda"}},
+	{"BN", "BRN", "096", []string{"Brunei Darussalam"}},
+	{"BO", "BOL", "068", []string{"Bolivia, Plurinational State of", "Bolivia", "Plurinational State of Bolivia"}},
+	{"BQ", "BES", "535", []string{"Bonaire, Sint Eustatius and Saba"}},
+	{"BR", "BRA", "076", []string{"Brazil", "Federative Republic of Brazil"}},
+	{"BS", "BHS", "044", []string{"Bahamas", "Commonwealth of the Bahamas"}},
+	{"BT", "BTN", "064", []string{"Bhutan", "Kingdom of Bhutan"}},
+	{"BV", "BVT", "074", []string{"Bouvet Island"}},
+	{"BW", "BWA", "072", []string{"Botswana", "Republic of Botswana"}},
+	{"BY", "BLR", "112", []string{"Belarus", "Republic of Belarus"}},
+	{"BZ", "BLZ", "084", []string{"Belize"}},
+	{"CA", "CAN", "124", []string{"Canada"}},
+	{"CC", "CCK", "166", []string{"Cocos (Keeling) Islands"}},
+	{"CD", "COD", "180", []string{"Congo, The Democratic Republic of the"}},
+	{"CF", "CAF", "140", []string{"Central African Republic"}},
+	{"CG", "COG", "178", []string{"Congo", "Republic of the Congo"}},
+	{"CH", "CHE", "756", []string{"Switzerland", "Swiss Confederation"}},
+	{"CI", "CIV", "384", []string{"Côte d'Ivoire", "Republic of Côte d'Ivoire"}},
+	{"CK", "COK", "184", []string{"Cook Islands"}},
+	{"CL", "CHL", "152", []string{"Chile", "Republic of Chile"}},
+	{"CM", "CMR", "120", []string{"Cameroon", "Republic of Cameroon"}},
+	{"CN", "CHN", "156", []string{"China", "People's Republic of China"}},
+	{"CO", "COL", "170", []string{"Colombia", "Republic of Colombia"}},
+	{"CR", "CRI", "188", []string{"Costa Rica", "Republic of Costa Rica"}},
+	{"CU", "CUB", "192", []string{"Cuba", "Republic of Cuba"}},
+	{"CV", "CPV", "132", []string{"Cabo Verde", "Republic of Cabo Verde"}},
+	{"CW", "CUW", "531", []string{"Curaçao"}},
+	{"CX", "CXR", "162", []string{"Christmas Island"}},
+	{"CY", "CYP", "196", []string{"Cyprus", "Republic of Cyprus"}},
+	{"CZ", "CZE", "203", []string{"Czechia", "Czech Republic"}},
+	{"DE", "DEU", "276", []string{"Germany", "Federal Republic of Germany"}},
+	{"DJ", "DJI", "262", []string{"Djibouti", "Republic of Djibouti"}},
+	{"DK", "DNK", "208", []string{"Denmark", "Kingdom of Denmark"}},
+	{"DM", "DMA", "212", []string{"Dominica", "Commonwealth of Dominica"}},
+	{"DO", "DOM", "214", []string{"Dominican Republic"}},
+	{"DZ", "DZA", "012", []string{"Algeria", "People's Democratic Republic of Algeria"}},
+	{"EC", "ECU", "218", []string{"Ecuador", "Republic of Ecuador"}},
+	{"EE", "EST", "233", []string{"Estonia", "Republic of Estonia"}},
+	{"EG", "EGY", "818", []string{"Egypt", "Arab Republic of Egypt"}},
+	{"EH", "ESH", "732", []string{"Western Sahara"}},
+	{"ER", "ERI", "232", []string{"Eritrea", "the State of Eritrea"}},
+	{"ES", "ESP", "724", []string{"Spain", "Kingdom of Spain"}},
+	{"ET", "ETH", "231", []string{"Ethiopia", "Federal Democratic Republic of Ethiopia"}},
+	{"FI", "FIN", "246", []string{"Finland", "Republic of Finland"}},
+	{"FJ", "FJI", "242", []string{"Fiji", "Republic of Fiji"}},
+	{"FK", "FLK", "238", []string{"Falkland Islands (Malvinas)"}},
+	{"FM", "FSM", "583", []string{"Micronesia, Federated States of", "Federated States of Micronesia"}},
+	{"FO", "FRO", "234", []string{"Faroe Islands"}},
+	{"FR", "FRA", "250", []string{"France", "French Republic"}},
+	{"GA", "GAB", "266", []string{"Gabon", "Gabonese Republic"}},
+	{"GB", "GBR", "826", []string{"United Kingdom", "United Kingdom of Great Britain and Northern Ireland"}},
+	{"GD", "GRD", "308", []string{"Grenada"}},
+	{"GE", "GEO", "268", []string{"Georgia"}},
+	{"GF", "GUF", "254", []string{"French Guiana"}},
+	{"GG", "GGY", "831", []string{"Guernsey"}},
+	{"GH", "GHA", "288", []string{"Ghana", "Republic of Ghana"}},
+	{"GI", "GIB", "292", []string{"Gibraltar"}},
+	{"GL", "GRL", "304", []string{"Greenland"}},
+	{"GM", "GMB", "270", []string{"Gambia", "Republic of the Gambia"}},
+	{"GN", "GIN", "324", []string{"Guinea", "Republic of Guinea"}},
+	{"GP", "GLP", "312", []string{"Guadeloupe"}},
+	{"GQ", "GNQ", "226", []string{"Equatorial Guinea", "Republic of Equatorial Guinea"}},
+	{"GR", "GRC", "300", []string{"Greece", "Hellenic Republic"}},
+	{"GS", "SGS", "239", []string{"South Georgia and the South Sandwich Islands"}},
+	{"GT", "GTM", "320", []string{"Guatemala", "Republic of Guatemala"}},
+	{"GU", "GUM", "316", []string{"Guam"}},
+	{"GW", "GNB", "624", []string{"Guinea-Bissau", "Republic of Guinea-Bissau"}},
+	{"GY", "GUY", "328", []string{"Guyana", "Republic of Guyana"}},
+	{"HK", "HKG", "344", []string{"Hong Kong", "Hong Kong Special Administrative Region of China"}},
+	{"HM", "HMD", "334", []string{"Heard Island and McDonald Islands"}},
+	{"HN", "HND", "340", []string{"Honduras", "Republic of Honduras"}},
+	{"HR", "HRV", "191", []string{"Croatia", "Republic of Croatia"}},
+	{"HT", "HTI", "332", []string{"Haiti", "Republic of Haiti"}},
+	{"HU", "HUN", "348", []string{"Hungary"}},
+	{"ID", "IDN", "360", []string{"Indonesia", "Republic of Indonesia"}},
+	{"IE", "IRL", "372", []string{"Ireland"}},
+	{"IL", "ISR", "376", []string{"Israel", "State of Israel"}},
+	{"IM", "IMN", "833", []string{"Isle of Man"}},
+	{"IN", "IND", "356", []string{"India", "Republic of India"}},
+	{"IO", "IOT", "086", []string{"British Indian Ocean Territory"}},
+	{"IQ", "IRQ", "368", []string{"Iraq", "Republic of Iraq"}},
+	{"IR", "IRN", "364", []string{"Iran, Islamic Republic of", "Iran", "Islamic Republic of Iran"}},
+	{"IS", "ISL", "352", []string{"Iceland", "Republic of Iceland"}},
+	{"IT", "ITA", "380", []string{"Italy", "Italian Republic"}},
+	{"JE", "JEY", "832", []string{"Jersey"}},
+	{"JM", "JAM", "388", []string{"Jamaica"}},
+	{"JO", "JOR", "400", []string{"Jordan", "Hashemite Kingdom of Jordan"}},
+	{"JP", "JPN", "392", []string{"Japan"}},
+	{"KE", "KEN", "404", []string{"Kenya", "Republic of Kenya"}},
+	{"KG", "KGZ", "417", []string{"Kyrgyzstan", "Kyrgyz Republic"}},
+	{"KH", "KHM", "116", []string{"Cambodia", "Kingdom of Cambodia"}},
+	{"KI", "KIR", "296", []string{"Kiribati", "Republic of Kiribati"}},
+	{"KM", "COM", "174", []string{"Comoros", "Union of the Comoros"}},
+	{"KN", "KNA", "659", []string{"Saint Kitts and Nevis"}},
+	{"KP", "PRK", "408", []string{"Korea, Democratic People's Republic of", "North Korea", "Democratic People's Republic of Korea"}},
+	{"KR", "KOR", "410", []string{"Korea, Republic of", "South Korea"}},
+	{"KW", "KWT", "414", []string{"Kuwait", "State of Kuwait"}},
+	{"KY", "CYM", "136", []string{"Cayman Islands"}},
+	{"KZ", "KAZ", "398", []string{"Kazakhstan", "Republic of Kazakhstan"}},
+	{"LA", "LAO", "418", []string{"Lao People's Democratic Republic", "Laos"}},
+	{"LB", "LBN", "422", []string{"Lebanon", "Lebanese Republic"}},
+	{"LC", "LCA", "662", []string{"Saint Lucia"}},
+	{"LI", "LIE", "438", []string{"Liechtenstein", "Principality of Liechtenstein"}},
+	{"LK", "LKA", "144", []string{"Sri Lanka", "Democratic Socialist Republic of Sri Lanka"}},
+	{"LR", "LBR", "430", []string{"Liberia", "Republic of Liberia"}},
+	{"LS", "LSO", "426", []string{"Lesotho", "Kingdom of Lesotho"}},
+	{"LT", "LTU", "440", []string{"Lithuania", "Republic of Lithuania"}},
+	{"LU", "LUX", "442", []string{"Luxembourg", "Grand Duchy of Luxembourg"}},
+	{"LV", "LVA", "428", []string{"Latvia", "Republic of Latvia"}},
+	{"LY", "LBY", "434", []string{"Libya"}},
+	{"MA", "MAR", "504", []string{"Morocco", "Kingdom of Morocco"}},
+	{"MC", "MCO", "492", []string{"Monaco", "Principality of Monaco"}},
+	{"MD", "MDA", "498", []string{"Moldova, Republic of", "Moldova", "Republic of Moldova"}},
+	{"ME", "MNE", "499", []string{"Montenegro"}},
+	{"MF", "MAF", "663", []string{"Saint Martin (French part)"}},
+	{"MG", "MDG", "450", []string{"Madagascar", "Republic of Madagascar"}},
+	{"MH", "MHL", "584", []string{"Marshall Islands", "Republic of the Marshall Islands"}},
+	{"MK", "MKD", "807", []string{"North Macedonia", "Republic of North Macedonia"}},
+	{"ML", "MLI", "466", []string{"Mali", "Republic of Mali"}},
+	{"MM", "MMR", "104", []string{"Myanmar", "Republic of Myanmar"}},
+	{"MN", "MNG", "496", []string{"Mongolia"}},
+	{"MO", "MAC", "446", []string{"Macao", "Macao Special Administrative Region of China"}},
+	{"MP", "MNP", "580", []string{"Northern Mariana Islands", "Commonwealth of the Northern Mariana Islands"}},
+	{"MQ", "MTQ", "474", []string{"Martinique"}},
+	{"MR", "MRT", "478", []string{"Mauritania", "Islamic Republic of Mauritania"}},
+	{"MS", "MSR", "500", []string{"Montserrat"}},
+	{"MT", "MLT", "470", []string{"Malta", "Republic of Malta"}},
+	{"MU", "MUS", "480", []string{"Mauritius", "Republic of Mauritius"}},
+	{"MV", "MDV", "462", []string{"Maldives", "Republic of Maldives"}},
+	{"MW", "MWI", "454", []string{"Malawi", "Republic of Malawi"}},
+	{"MX", "MEX", "484", []string{"Mexico", "United Mexican States"}},
+	{"MY", "MYS", "458", []string{"Malaysia"}},
+	{"MZ", "MOZ", "508", []string{"Mozambique", "Republic of Mozambique"}},
+	{"NA", "NAM", "516", []string{"Namibia", "Republic of Namibia"}},
+	{"NC", "NCL", "540", []string{"New Caledonia"}},
+	{"NE", "NER", "562", []string{"Niger", "Republic of the Niger"}},
+	{"NF", "NFK", "574", []string{"Norfolk Island"}},
+	{"NG", "NGA", "566", []string{"Nigeria", "Federal Republic of Nigeria"}},
+	{"NI", "NIC", "558", []string{"Nicaragua", "Republic of Nicaragua"}},
+	{"NL", "NLD", "528", []string{"Netherlands", "Kingdom of the Netherlands"}},
+	{"NO", "NOR", "578", []string{"Norway", "Kingdom of Norway"}},
+	{"NP", "NPL", "524", []string{"Nepal", "Federal Democratic Republic of Nepal"}},
+	{"NR", "NRU", "520", []string{"Nauru", "Republic of Nauru"}},
+	{"NU", "NIU", "570", []string{"Niue"}},
+	{"NZ", "NZL", "554", []string{"New Zealand"}},
+	{"OM", "OMN", "512", []string{"Oman", "Sultanate of Oman"}},
+	{"PA", "PAN", "591", []string{"Panama", "Republic of Panama"}},
+	{"PE", "PER", "604", []string{"Peru", "Republic of Peru"}},
+	{"PF", "PYF", "258", []string{"French Polynesia"}},
+	{"PG", "PNG", "598", []string{"Papua New Guinea", "Independent State of Papua New Guinea"}},
+	{"PH", "PHL", "608", []string{"Philippines", "Republic of the Philippines"}},
+	{"PK", "PAK", "586", []string{"Pakistan", "Islamic Republic of Pakistan"}},
+	{"PL", "POL", "616", []string{"Poland", "Republic of Poland"}},
+	{"PM", "SPM", "666", []string{"Saint Pierre and Miquelon"}},
+	{"PN", "PCN", "612", []string{"Pitcairn"}},
+	{"PR", "PRI", "630", []string{"Puerto Rico"}},
+	{"PS", "PSE", "275", []string{"Palestine, State of", "the State of Palestine"}},
+	{"PT", "PRT", "620", []string{"Portugal", "Portuguese Republic"}},
+	{"PW", "PLW", "585", []string{"Palau", "Republic of Palau"}},
+	{"PY", "PRY", "600", []string{"Paraguay", "Republic of Paraguay"}},
+	{"QA", "QAT", "634", []string{"Qatar", "State of Qatar"}},
+	{"RE", "REU", "638", []string{"Réunion"}},
+	{"RO", "ROU", "642", []string{"Romania"}},
+	{"RS", "SRB", "688", []string{"Serbia", "Republic of Serbia"}},
+	{"RU", "RUS", "643", []string{"Russian Federation"}},
+	{"RW", "RWA", "646", []string{"Rwanda", "Rwandese Republic"}},
+	{"SA", "SAU", "682", []string{"Saudi Arabia", "Kingdom of Saudi Arabia"}},
+	{"SB", "SLB", "090", []string{"Solomon Islands"}},
+	{"SC", "SYC", "690", []string{"Seychelles", "Republic of Seychelles"}},
+	{"SD", "SDN", "729", []string{"Sudan", "Republic of the Sudan"}},
+	{"SE", "SWE", "752", []string{"Sweden", "Kingdom of Sweden"}},
+	{"SG", "SGP", "702", []string{"Singapore", "Republic of Singapore"}},
+	{"SH", "SHN", "654", []string{"Saint Helena, Ascension and Tristan da Cunha"}},
+	{"SI", "SVN", "705", []string{"Slovenia", "Republic of Slovenia"}},
+	{"SJ", "SJM", "744", []string{"Svalbard and Jan Mayen"}},
+	{"SK", "SVK", "703", []string{"Slovakia", "Slovak Republic"}},
+	{"SL", "SLE", "694", []string{"Sierra Leone", "Republic of Sierra Leone"}},
+	{"SM", "SMR", "674", []string{"San Marino", "Republic of San Marino"}},
+	{"SN", "SEN", "686", []string{"Senegal", "Republic of Senegal"}},
+	{"SO", "SOM", "706", []string{"Somalia", "Federal Republic of Somalia"}},
+	{"SR", "SUR", "740", []string{"Suriname", "Republic of Suriname"}},
+	{"SS", "SSD", "728", []string{"South Sudan", "Republic of South Sudan"}},
+	{"ST", "STP", "678", []string{"Sao Tome and Principe", "Democratic Republic of Sao Tome and Principe"}},
+	{"SV", "SLV", "222", []string{"El Salvador", "Republic of El Salvador"}},
+	{"SX", "SXM", "534", []string{"Sint Maarten (Dutch part)"}},
+	{"SY", "SYR", "760", []string{"Syrian Arab Republic", "Syria"}},
+	{"SZ", "SWZ", "748", []string{"Eswatini", "Kingdom of Eswatini"}},
+	{"TC", "TCA", "796", []string{"Turks and Caicos Islands"}},
+	{"TD", "TCD", "148", []string{"Chad", "Republic of Chad"}},
+	{"TF", "ATF", "260", []string{"French Southern Territories"}},
+	{"TG", "TGO", "768", []string{"Togo", "Togolese Republic"}},
+	{"TH", "THA", "764", []string{"Thailand", "Kingdom of Thailand"}},
+	{"TJ", "TJK", "762", []string{"Tajikistan", "Republic of Tajikistan"}},
+	{"TK", "TKL", "772", []string{"Tokelau"}},
+	{"TL", "TLS", "626", []string{"Timor-Leste", "Democratic Republic of Timor-Leste"}},
+	{"TM", "TKM", "795", []string{"Turkmenistan"}},
+	{"TN", "TUN", "788", []string{"Tunisia", "Republic of Tunisia"}},
+	{"TO", "TON", "776", []string{"Tonga", "Kingdom of Tonga"}},
+	{"TR", "TUR", "792", []string{"Türkiye", "Republic of Türkiye"}},
+	{"TT", "TTO", "780", []string{"Trinidad and Tobago", "Republic of Trinidad and Tobago"}},
+	{"TV", "TUV", "798", []string{"Tuvalu"}},
+	{"TW", "TWN", "158", []string{"Taiwan, Province of China", "Taiwan"}},
+	{"TZ", "TZA", "834", []string{"Tanzania, United Republic of", "Tanzania", "United Republic of Tanzania"}},
+	{"UA", "UKR", "804", []string{"Ukraine"}},
+	{"UG", "UGA", "800", []string{"Uganda", "Republic of Uganda"}},
+	{"UM", "UMI", "581", []string{"United States Minor Outlying Islands"}},
+	{"US", "USA", "840", []string{"United States", "United States of America"}},
+	{"UY", "URY", "858", []string{"Uruguay", "Eastern Republic of Uruguay"}},
+	{"UZ", "UZB", "860", []string{"Uzbekistan", "Republic of Uzbekistan"}},
+	{"VA", "VAT", "336", []string{"Holy See (Vatican City State)"}},
+	{"VC", "VCT", "670", []string{"Saint Vincent and the Grenadines"}},
+	{"VE", "VEN", "862", []string{"Venezuela, Bolivarian Republic of", "Venezuela", "Bolivarian Republic of Venezuela"}},
+	{"VG", "VGB", "092", []string{"Virgin Islands, British", "British Virgin Islands"}},
+	{"VI", "VIR", "850", []string{"Virgin Islands, U.S.", "Virgin Islands of the United States"}},
+	{"VN", "VNM", "704", []string{"Viet Nam", "Vietnam", "Socialist Republic of Viet Nam"}},
+	{"VU", "VUT", "548", []string{"Vanuatu", "Republic of Vanuatu"}},
+	{"WF", "WLF", "876", []string{"Wallis and Futuna"}},
+	{"WS", "WSM", "882", []string{"Samoa", "Independent State of Samoa"}},
+	{"YE", "YEM", "887", []string{"Yemen", "Republic of Yemen"}},
+	{"YT", "MYT", "175", []string{"Mayotte"}},
+	{"ZA", "ZAF", "710", []string{"South Africa", "Republic of South Africa"}},
+	{"ZM", "ZMB", "894", []string{"Zambia", "Republic of Zambia"}},
+	{"ZW", "ZWE", "716", []string{"Zimbabwe", "Republic of Zimbabwe"}},
+}
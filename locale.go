@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLocale is used when none of the requested locales are shipped by the database
+const defaultLocale = "en"
+
+type acceptedLocale struct {
+	tag string
+	q   float64
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language value, most preferred first.  A bare locale
+// such as "de" is a valid value, so this also parses the "locale" request field.
+func parseAcceptLanguage(in string) []string {
+	accepted := make([]acceptedLocale, 0)
+	for _, part := range strings.Split(in, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		al := acceptedLocale{tag: strings.ReplaceAll(tag, "_", "-"), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && strings.EqualFold(param[:2], "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					al.q = q
+				}
+			}
+		}
+		if al.q > 0 {
+			accepted = append(accepted, al)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+	out := make([]string, len(accepted))
+	for i, al := range accepted {
+		out[i] = al.tag
+	}
+	return out
+}
+
+func primaryLanguage(tag string) string {
+	if i := strings.Index(tag, "-"); i > 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// negotiateLocale picks the supported locale best matching the requested ones.  An exact match is preferred, then
+// one with the same primary language, so "pt" selects "pt-BR" and "en-US" selects "en".
+func negotiateLocale(requested string, supported []string) string {
+	for _, tag := range parseAcceptLanguage(requested) {
+		for _, s := range supported {
+			if strings.EqualFold(tag, s) {
+				return s
+			}
+		}
+		for _, s := range supported {
+			if strings.EqualFold(primaryLanguage(tag), primaryLanguage(s)) {
+				return s
+			}
+		}
+	}
+	return defaultLocale
+}
+
+// localizedName returns the name in locale, falling back to the default locale
+func localizedName(names map[string]string, locale string) string {
+	if name, ok := names[locale]; ok {
+		return name
+	}
+	return names[defaultLocale]
+}
+
+// LocalesResult advertises the locales shipped by each loaded edition
+type LocalesResult struct {
+	Default  string              `json:"default"`
+	Locales  []string            `json:"locales"`
+	Editions map[string][]string `json:"editions"`
+}
+
+func (g *geoman) locales() *LocalesResult {
+	var (
+		snap = g.registry.snapshot()
+		seen = make(map[string]struct{})
+		res  = &LocalesResult{
+			Default:  defaultLocale,
+			Locales:  make([]string, 0),
+			Editions: make(map[string][]string),
+		}
+	)
+
+	for _, editionID := range snap.editionIDs {
+		er, ok := snap.readers[editionID]
+		if !ok || len(er.metadata.Languages) == 0 {
+			continue
+		}
+		res.Editions[editionID] = er.metadata.Languages
+		for _, l := range er.metadata.Languages {
+			if _, ok := seen[l]; !ok {
+				seen[l] = struct{}{}
+				res.Locales = append(res.Locales, l)
+			}
+		}
+	}
+
+	sort.Strings(res.Locales)
+
+	return res
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	stdlog "log"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -28,6 +29,9 @@ func main() {
 		sigc chan os.Signal
 		fs   *flag.FlagSet
 		err  error
+
+		trustedProxies string
+		canaryIP       string
 	)
 
 	svc = new(webservice)
@@ -37,7 +41,19 @@ func main() {
 	fs.StringVar(&svc.httpAddr, "bind-http", ":8283", "Address and port to bind http")
 	fs.StringVar(&gm.confFile, "geolite-conf", "/tmp/gipman/GeoIP.conf", "GeoLite 2 updater conf file")
 	fs.StringVar(&gm.dbDir, "geolite-db-dir", "/tmp/gipman/db/", "Directory to store GeoLite 2 binary databases")
-	fs.StringVar(&gm.updateInterval, "update-interval", "168h", "Rate at which to update GeoLite 2 Country DB [default=7 days]")
+	fs.DurationVar(&gm.updateInterval, "update-interval", 168*time.Hour, "Rate at which to update GeoLite 2 Country DB when no update schedule is set [default=7 days]")
+	fs.StringVar(&gm.updateCron, "update-schedule", "", "Cron expression of update times, e.g. \"0 4 * * 3\" for 04:00 every Wednesday.  Overrides -update-interval")
+	fs.StringVar(&gm.updateTimezone, "update-timezone", "UTC", "Time zone the update schedule is evaluated in, e.g. \"America/Chicago\"")
+	fs.DurationVar(&gm.updateJitter, "update-jitter", 0, "Maximum random delay added to each scheduled update")
+	fs.DurationVar(&gm.retryInterval, "retry-interval", 30*time.Second, "Initial delay between attempts to load or download missing databases, doubling up to -retry-max-interval")
+	fs.DurationVar(&gm.retryMaxInterval, "retry-max-interval", 5*time.Minute, "Maximum delay between attempts to load or download missing databases")
+	fs.StringVar(&gm.degradedDecision, "degraded-decision", "", "Decision returned while a configured database a lookup needs is not loaded, \"allowed\" (fail open) or \"denied\" (fail closed).  Lookups respond with a 503 when empty")
+	fs.StringVar(&canaryIP, "canary-ip", "8.8.8.8", "IP looked up in every edition by the readiness check")
+	fs.DurationVar(&gm.maxDataAge, "max-data-age", 0, "Readiness fails once a database was built longer ago than this, disabled when 0")
+	fs.StringVar(&gm.policies.dir, "policy-dir", "/tmp/gipman/policies/", "Directory to store named lookup policies")
+	fs.StringVar(&trustedProxies, "trusted-proxies", "", "Comma separated CIDRs of proxies whose forwarding headers are trusted")
+	fs.IntVar(&gm.maxBatchSize, "max-batch-size", 1000, "Maximum number of lookups accepted in a single batch request, whose body is limited to 64KiB per lookup")
+	fs.IntVar(&gm.maxResolveEntries, "max-resolve-entries", 100, "Maximum number of entries accepted in a single country resolve request, entries are limited to 64 bytes and the body to 1KiB per entry")
 
 	log = zerolog.New(zerolog.NewConsoleWriter(zerologWriterConfig)).
 		With().
@@ -56,6 +72,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	if svc.trustedProxies, err = parseTrustedProxies(trustedProxies); err != nil {
+		log.Error().Err(err).Msg("Error parsing flags")
+		os.Exit(1)
+	}
+
+	if gm.canaryIP = net.ParseIP(canaryIP); gm.canaryIP == nil {
+		log.Error().Str("canary-ip", canaryIP).Msg("Invalid canary IP")
+		os.Exit(1)
+	}
+
+	// policies are loaded before serving, so every stored policy can be referenced by the first request
+	if err = gm.policies.load(gm.log); err != nil {
+		log.Error().Err(err).Msg("Error loading policies")
+		os.Exit(1)
+	}
+
 	errc = make(chan error, 1)
 	sigc = make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mimePrometheusText is the content type of the prometheus text exposition format
+const mimePrometheusText = "text/plain; version=0.0.4; charset=utf-8"
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency histogram buckets
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type lookupKey struct {
+	outcome     string
+	matchedType string
+	country     string
+}
+
+type requestKey struct {
+	route  string
+	method string
+	code   string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, upper := range latencyBuckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// metrics collects the counters exposed at /metrics.  The zero value is ready for use.
+type metrics struct {
+	mu              sync.Mutex
+	lookups         map[lookupKey]uint64
+	requests        map[requestKey]*histogram
+	updateAttempts  map[string]uint64
+	updateSuccesses map[string]uint64
+	updateFailures  map[string]uint64
+	lastUpdate      map[string]time.Time
+}
+
+// observeLookup counts a single evaluated lookup.  Errors are counted with an "error" outcome.  Only policy
+// decisions are counted, direct city, asn, anonymous and enrich lookups are seen in the request latencies alone.
+func (m *metrics) observeLookup(dec *LookupDecision, err error) {
+	key := lookupKey{outcome: "error", matchedType: "none", country: "unknown"}
+	if err == nil {
+		key.outcome = dec.Decision
+		if matchedType := decisionMatchedType(dec); matchedType != "" {
+			key.matchedType = matchedType
+		}
+		if dec.country != "" {
+			key.country = dec.country
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lookups == nil {
+		m.lookups = make(map[lookupKey]uint64)
+	}
+	m.lookups[key]++
+}
+
+// decisionMatchedType picks the matched_type label of a decision: the type of the first rule that matched, in
+// evaluation order.  evaluatePolicy appends matches as it evaluates cidr, anonymous, country, continent then asn
+// rules, so that is the first match.
+func decisionMatchedType(dec *LookupDecision) string {
+	for _, m := range dec.Matches {
+		if m.MatchedType != "" {
+			return m.MatchedType
+		}
+	}
+	return ""
+}
+
+func (m *metrics) observeRequest(route, method string, code int, d time.Duration) {
+	key := requestKey{route: route, method: method, code: strconv.Itoa(code)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == nil {
+		m.requests = make(map[requestKey]*histogram)
+	}
+	h, ok := m.requests[key]
+	if !ok {
+		h = new(histogram)
+		m.requests[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// observeUpdate counts an attempt to download an edition, and its outcome
+func (m *metrics) observeUpdate(editionID string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.updateAttempts == nil {
+		m.updateAttempts = make(map[string]uint64)
+		m.updateSuccesses = make(map[string]uint64)
+		m.updateFailures = make(map[string]uint64)
+	}
+	if m.lastUpdate == nil {
+		m.lastUpdate = make(map[string]time.Time)
+	}
+	m.updateAttempts[editionID]++
+	if err != nil {
+		m.updateFailures[editionID]++
+		return
+	}
+	m.updateSuccesses[editionID]++
+	m.lastUpdate[editionID] = time.Now()
+}
+
+// setLastUpdate seeds the time of the last successful download of an edition, as recorded before a restart
+func (m *metrics) setLastUpdate(editionID string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastUpdate == nil {
+		m.lastUpdate = make(map[string]time.Time)
+	}
+	m.lastUpdate[editionID] = at
+}
+
+// metricsSnapshot is a copy of the counters, so they may be written out without holding the lock
+type metricsSnapshot struct {
+	lookups         map[lookupKey]uint64
+	requests        map[requestKey]histogram
+	updateAttempts  map[string]uint64
+	updateSuccesses map[string]uint64
+	updateFailures  map[string]uint64
+	lastUpdate      map[string]time.Time
+}
+
+func copyCounters(in map[string]uint64) map[string]uint64 {
+	out := make(map[string]uint64, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func (m *metrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := metricsSnapshot{
+		lookups:         make(map[lookupKey]uint64, len(m.lookups)),
+		requests:        make(map[requestKey]histogram, len(m.requests)),
+		updateAttempts:  copyCounters(m.updateAttempts),
+		updateSuccesses: copyCounters(m.updateSuccesses),
+		updateFailures:  copyCounters(m.updateFailures),
+		lastUpdate:      make(map[string]time.Time, len(m.lastUpdate)),
+	}
+	for k, v := range m.lookups {
+		s.lookups[k] = v
+	}
+	for k, h := range m.requests {
+		s.requests[k] = histogram{counts: append([]uint64(nil), h.counts...), count: h.count, sum: h.sum}
+	}
+	for k, v := range m.lastUpdate {
+		s.lastUpdate[k] = v
+	}
+	return s
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds, as required by the text format
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatLabels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", pairs[i], escapeLabelValue(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeEditionCounter(w io.Writer, name, help string, values map[string]uint64) {
+	writeHeader(w, name, "counter", help)
+	for _, editionID := range sortedKeys(values) {
+		_, _ = fmt.Fprintf(w, "%s%s %d\n", name, formatLabels("edition", editionID), values[editionID])
+	}
+}
+
+func sortedKeys(in map[string]uint64) []string {
+	out := make([]string, 0, len(in))
+	for k := range in {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeTo writes every metric in the prometheus text exposition format.  Database build epochs are read from snap.
+// The counters are copied first, so a slow scraper never holds up the lookups being counted.
+func (m *metrics) writeTo(out io.Writer, snap *readerSnapshot, now time.Time) error {
+	var (
+		w  = bufio.NewWriter(out)
+		ms = m.snapshot()
+	)
+
+	writeHeader(w, "gipman_lookups_total", "counter", "Policy decisions evaluated, by outcome, first matched type and resolved country.")
+	lookupKeys := make([]lookupKey, 0, len(ms.lookups))
+	for k := range ms.lookups {
+		lookupKeys = append(lookupKeys, k)
+	}
+	sort.Slice(lookupKeys, func(i, j int) bool {
+		a, b := lookupKeys[i], lookupKeys[j]
+		if a.outcome != b.outcome {
+			return a.outcome < b.outcome
+		}
+		if a.matchedType != b.matchedType {
+			return a.matchedType < b.matchedType
+		}
+		return a.country < b.country
+	})
+	for _, k := range lookupKeys {
+		_, _ = fmt.Fprintf(w, "gipman_lookups_total%s %d\n",
+			formatLabels("outcome", k.outcome, "matched_type", k.matchedType, "country", k.country), ms.lookups[k])
+	}
+
+	writeHeader(w, "gipman_http_request_duration_seconds", "histogram", "HTTP request latency, by route, method and status code.")
+	requestKeys := make([]requestKey, 0, len(ms.requests))
+	for k := range ms.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, k := range requestKeys {
+		h := ms.requests[k]
+		for i, upper := range latencyBuckets {
+			_, _ = fmt.Fprintf(w, "gipman_http_request_duration_seconds_bucket%s %d\n",
+				formatLabels("route", k.route, "method", k.method, "code", k.code, "le", formatFloat(upper)), h.counts[i])
+		}
+		labels := formatLabels("route", k.route, "method", k.method, "code", k.code)
+		_, _ = fmt.Fprintf(w, "gipman_http_request_duration_seconds_bucket%s %d\n",
+			formatLabels("route", k.route, "method", k.method, "code", k.code, "le", "+Inf"), h.count)
+		_, _ = fmt.Fprintf(w, "gipman_http_request_duration_seconds_sum%s %s\n", labels, formatFloat(h.sum))
+		_, _ = fmt.Fprintf(w, "gipman_http_request_duration_seconds_count%s %d\n", labels, h.count)
+	}
+
+	writeEditionCounter(w, "gipman_update_attempts_total", "Database download attempts, by edition.", ms.updateAttempts)
+	writeEditionCounter(w, "gipman_update_successes_total", "Successful database downloads, by edition.", ms.updateSuccesses)
+	writeEditionCounter(w, "gipman_update_failures_total", "Failed database downloads, by edition.", ms.updateFailures)
+
+	writeHeader(w, "gipman_seconds_since_last_update", "gauge", "Seconds since the last successful download, by edition.")
+	editionIDs := make([]string, 0, len(ms.lastUpdate))
+	for editionID := range ms.lastUpdate {
+		editionIDs = append(editionIDs, editionID)
+	}
+	sort.Strings(editionIDs)
+	for _, editionID := range editionIDs {
+		_, _ = fmt.Fprintf(w, "gipman_seconds_since_last_update%s %s\n",
+			formatLabels("edition", editionID), formatFloat(now.Sub(ms.lastUpdate[editionID]).Seconds()))
+	}
+
+	writeHeader(w, "gipman_database_build_epoch_seconds", "gauge", "Build time of the loaded database, by edition.")
+	for _, editionID := range snap.editionIDs {
+		if er, err := snap.edition(editionID); err == nil {
+			_, _ = fmt.Fprintf(w, "gipman_database_build_epoch_seconds%s %d\n",
+				formatLabels("edition", editionID, "database_type", er.metadata.DatabaseType), er.metadata.BuildEpoch)
+		}
+	}
+
+	return w.Flush()
+}
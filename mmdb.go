@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The geoip2 readers keep their metadata to themselves, so gipman carries a small MaxMind DB decoder of its own.
+// See https://maxmind.github.io/MaxMind-DB/ for the format.
+
+const (
+	mmdbTypeExtended  = 0
+	mmdbTypePointer   = 1
+	mmdbTypeString    = 2
+	mmdbTypeFloat64   = 3
+	mmdbTypeBytes     = 4
+	mmdbTypeUint16    = 5
+	mmdbTypeUint32    = 6
+	mmdbTypeMap       = 7
+	mmdbTypeInt32     = 8
+	mmdbTypeUint64    = 9
+	mmdbTypeUint128   = 10
+	mmdbTypeSlice     = 11
+	mmdbTypeContainer = 12
+	mmdbTypeEndMarker = 13
+	mmdbTypeBool      = 14
+	mmdbTypeFloat32   = 15
+)
+
+var mmdbMetadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMaxDepth bounds how deeply maps, arrays and pointers may nest
+const mmdbMaxDepth = 512
+
+var errMMDBInvalidOffset = errors.New("mmdb: invalid offset")
+
+type mmdbMetadata struct {
+	DatabaseType string
+	Languages    []string
+	Description  map[string]string
+	BuildEpoch   uint64
+	IPVersion    uint16
+	NodeCount    uint32
+	RecordSize   uint16
+}
+
+// mmdbDecoder decodes values from a single section of a MaxMind DB.  Pointers are resolved relative to the start
+// of buf, so buf must be the full data section when decoding records.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d mmdbDecoder) decodeControl(offset uint) (byte, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errMMDBInvalidOffset
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := ctrl >> 5
+	if typ == mmdbTypeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errMMDBInvalidOffset
+		}
+		typ = d.buf[offset] + 7
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if typ == mmdbTypePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, errMMDBInvalidOffset
+	}
+	size = uint(mmdbUint(d.buf[offset : offset+n]))
+	switch n {
+	case 1:
+		size += 29
+	case 2:
+		size += 285
+	default:
+		size += 65821
+	}
+	return typ, size, offset + n, nil
+}
+
+func (d mmdbDecoder) decodePointer(size, offset uint) (uint, uint, error) {
+	n := ((size >> 3) & 0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errMMDBInvalidOffset
+	}
+	var prefix uint
+	if n != 4 {
+		prefix = size & 0x7
+	}
+	ptr := prefix
+	for _, b := range d.buf[offset : offset+n] {
+		ptr = ptr<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		ptr += 2048
+	case 3:
+		ptr += 526336
+	}
+	return ptr, offset + n, nil
+}
+
+// decode returns the value at offset and the offset immediately following it.  Maps decode to
+// map[string]interface{}, arrays to []interface{}, and numeric types to their natural Go type.
+func (d mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+// decodeDepth decodes the value at offset, nested depth maps, arrays and pointers deep.  A corrupt database may
+// point a value back at a map or array containing it, so nesting is bounded as libmaxminddb does.
+func (d mmdbDecoder) decodeDepth(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("mmdb: data nested more than %d levels deep", mmdbMaxDepth)
+	}
+
+	typ, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == mmdbTypePointer {
+		ptr, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// the spec forbids pointers to pointers, following one could recurse forever on a corrupt database
+		if typ, _, _, err := d.decodeControl(ptr); err != nil {
+			return nil, 0, err
+		} else if typ == mmdbTypePointer {
+			return nil, 0, fmt.Errorf("mmdb: pointer to another pointer at %d", ptr)
+		}
+		v, _, err := d.decodeDepth(ptr, depth+1)
+		return v, next, err
+	}
+
+	switch typ {
+	case mmdbTypeMap:
+		out := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			if k, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("mmdb: map key has type %T, expected string", k)
+			}
+			if v, offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			out[ks] = v
+		}
+		return out, offset, nil
+
+	case mmdbTypeSlice:
+		out := make([]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			if out[i], offset, err = d.decodeDepth(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return out, offset, nil
+
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+
+	case mmdbTypeContainer, mmdbTypeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errMMDBInvalidOffset
+	}
+	raw := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case mmdbTypeString:
+		return string(raw), next, nil
+	case mmdbTypeBytes:
+		return append([]byte(nil), raw...), next, nil
+	case mmdbTypeFloat64:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("mmdb: invalid float64 size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), next, nil
+	case mmdbTypeFloat32:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("mmdb: invalid float32 size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), next, nil
+	case mmdbTypeUint16:
+		return uint16(mmdbUint(raw)), next, nil
+	case mmdbTypeUint32:
+		return uint32(mmdbUint(raw)), next, nil
+	case mmdbTypeInt32:
+		return int32(uint32(mmdbUint(raw))), next, nil
+	case mmdbTypeUint64:
+		return mmdbUint(raw), next, nil
+	case mmdbTypeUint128:
+		// gipman never needs these, keep the raw bytes
+		return append([]byte(nil), raw...), next, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unknown data type %d", typ)
+	}
+}
+
+func mmdbUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// readMMDBMetadata locates and decodes the metadata section of a MaxMind DB
+func readMMDBMetadata(buf []byte) (*mmdbMetadata, error) {
+	start := bytes.LastIndex(buf, mmdbMetadataStartMarker)
+	if start == -1 {
+		return nil, errors.New("mmdb: metadata section not found")
+	}
+
+	v, _, err := mmdbDecoder{buf: buf[start+len(mmdbMetadataStartMarker):]}.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: error decoding metadata: %w", err)
+	}
+	raw, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mmdb: metadata has type %T, expected map", v)
+	}
+
+	md := new(mmdbMetadata)
+	md.DatabaseType, _ = raw["database_type"].(string)
+	md.BuildEpoch, _ = raw["build_epoch"].(uint64)
+	md.IPVersion, _ = raw["ip_version"].(uint16)
+	md.NodeCount, _ = raw["node_count"].(uint32)
+	md.RecordSize, _ = raw["record_size"].(uint16)
+	if langs, ok := raw["languages"].([]interface{}); ok {
+		for _, l := range langs {
+			if ls, ok := l.(string); ok {
+				md.Languages = append(md.Languages, ls)
+			}
+		}
+	}
+	if desc, ok := raw["description"].(map[string]interface{}); ok {
+		md.Description = make(map[string]string, len(desc))
+		for k, d := range desc {
+			if ds, ok := d.(string); ok {
+				md.Description[k] = ds
+			}
+		}
+	}
+
+	if md.DatabaseType == "" {
+		return nil, errors.New("mmdb: metadata is missing database_type")
+	}
+
+	return md, nil
+}
+
+// walkMMDBData decodes each top level value of the data section of a MaxMind DB in turn, passing it to fn
+func walkMMDBData(buf []byte, md *mmdbMetadata, fn func(interface{})) error {
+	start := uint(md.NodeCount)*uint(md.RecordSize)/4 + 16
+	end := bytes.LastIndex(buf, mmdbMetadataStartMarker)
+	if end == -1 || start > uint(end) {
+		return errors.New("mmdb: data section not found")
+	}
+
+	d := mmdbDecoder{buf: buf[start:end]}
+	for offset := uint(0); offset < uint(len(d.buf)); {
+		v, next, err := d.decode(offset)
+		if err != nil {
+			return fmt.Errorf("mmdb: error decoding data section at offset %d: %w", offset, err)
+		}
+		fn(v)
+		offset = next
+	}
+
+	return nil
+}
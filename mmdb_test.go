@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMMDBDecoderDecode(t *testing.T) {
+	// a pointer with a two byte payload is offset by 2048, so its target lives past a block of padding
+	farPointer := append(make([]byte, 2048), 0x43, 'f', 'a', 'r')
+	farPointer = append(farPointer, 0x28, 0x00, 0x00)
+
+	longString := bytes.Repeat([]byte{'x'}, 30)
+
+	tests := []struct {
+		name     string
+		buf      []byte
+		offset   uint
+		want     interface{}
+		wantNext uint
+		wantErr  bool
+	}{
+		{
+			name:     "string",
+			buf:      []byte{0x43, 'f', 'o', 'o'},
+			want:     "foo",
+			wantNext: 4,
+		},
+		{
+			name:     "long string size",
+			buf:      append([]byte{0x5d, 0x01}, longString...),
+			want:     string(longString),
+			wantNext: 32,
+		},
+		{
+			name:     "uint16",
+			buf:      []byte{0xa2, 0x01, 0x02},
+			want:     uint16(0x0102),
+			wantNext: 3,
+		},
+		{
+			name:     "uint32",
+			buf:      []byte{0xc3, 0x01, 0x02, 0x03},
+			want:     uint32(0x010203),
+			wantNext: 4,
+		},
+		{
+			name:     "float64",
+			buf:      []byte{0x68, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0},
+			want:     1.5,
+			wantNext: 9,
+		},
+		{
+			name:     "extended int32",
+			buf:      []byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xfe},
+			want:     int32(-2),
+			wantNext: 6,
+		},
+		{
+			name:     "extended uint64",
+			buf:      []byte{0x04, 0x02, 0x5f, 0x5e, 0x10, 0x00},
+			want:     uint64(1600000000),
+			wantNext: 6,
+		},
+		{
+			name:     "extended bool",
+			buf:      []byte{0x01, 0x07},
+			want:     true,
+			wantNext: 2,
+		},
+		{
+			name:     "extended float32",
+			buf:      []byte{0x04, 0x08, 0x3f, 0xc0, 0x00, 0x00},
+			want:     float32(1.5),
+			wantNext: 6,
+		},
+		{
+			name:     "extended array",
+			buf:      []byte{0x02, 0x04, 0x42, 'e', 'n', 0x42, 'd', 'e'},
+			want:     []interface{}{"en", "de"},
+			wantNext: 8,
+		},
+		{
+			name:     "map",
+			buf:      []byte{0xe2, 0x41, 'a', 0xa1, 0x01, 0x41, 'b', 0x41, 'c'},
+			want:     map[string]interface{}{"a": uint16(1), "b": "c"},
+			wantNext: 9,
+		},
+		{
+			name:     "pointer",
+			buf:      []byte{0x43, 'f', 'o', 'o', 0x20, 0x00},
+			offset:   4,
+			want:     "foo",
+			wantNext: 6,
+		},
+		{
+			name:     "pointers in a map",
+			buf:      []byte{0x43, 'f', 'o', 'o', 0xe2, 0x41, 'k', 0x20, 0x00, 0x20, 0x00, 0x20, 0x00},
+			offset:   4,
+			want:     map[string]interface{}{"k": "foo", "foo": "foo"},
+			wantNext: 13,
+		},
+		{
+			name:     "two byte pointer",
+			buf:      farPointer,
+			offset:   2052,
+			want:     "far",
+			wantNext: 2055,
+		},
+		{
+			name:    "truncated string",
+			buf:     []byte{0x43, 'f'},
+			wantErr: true,
+		},
+		{
+			name:    "truncated extended type",
+			buf:     []byte{0x04},
+			wantErr: true,
+		},
+		{
+			name:    "pointer out of range",
+			buf:     []byte{0x20, 0x10},
+			wantErr: true,
+		},
+		{
+			name:    "self referencing pointer",
+			buf:     []byte{0x20, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "map value pointing back to the map",
+			buf:     []byte{0xe1, 0x41, 'k', 0x20, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "array element pointing back to the array",
+			buf:     []byte{0x01, 0x04, 0x20, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "pointer to pointer",
+			buf:     []byte{0x43, 'f', 'o', 'o', 0x20, 0x00, 0x20, 0x04},
+			offset:  6,
+			wantErr: true,
+		},
+		{
+			name:    "non string map key",
+			buf:     []byte{0xe1, 0xa1, 0x01, 0x41, 'a'},
+			wantErr: true,
+		},
+		{
+			name:    "invalid float64 size",
+			buf:     []byte{0x64, 0, 0, 0, 0},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := mmdbDecoder{buf: tt.buf}.decode(tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decode(%d) error = %v, wantErr %t", tt.offset, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode(%d) = %#v, want %#v", tt.offset, got, tt.want)
+			}
+			if next != tt.wantNext {
+				t.Errorf("decode(%d) next = %d, want %d", tt.offset, next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestReadMMDBMetadataAndWalk(t *testing.T) {
+	var buf []byte
+
+	// an empty search tree of zero nodes followed by the 16 byte data section separator
+	buf = append(buf, make([]byte, 16)...)
+	// data section: a string, then a pointer back to it
+	buf = append(buf, 0x43, 'f', 'o', 'o', 0x20, 0x00)
+	buf = append(buf, mmdbMetadataStartMarker...)
+	buf = append(buf,
+		0xe6,
+		0x4d, 'd', 'a', 't', 'a', 'b', 'a', 's', 'e', '_', 't', 'y', 'p', 'e',
+		0x50, 'G', 'e', 'o', 'L', 'i', 't', 'e', '2', '-', 'C', 'o', 'u', 'n', 't', 'r', 'y',
+		0x4b, 'b', 'u', 'i', 'l', 'd', '_', 'e', 'p', 'o', 'c', 'h',
+		0x04, 0x02, 0x5f, 0x5e, 0x10, 0x00,
+		0x4a, 'n', 'o', 'd', 'e', '_', 'c', 'o', 'u', 'n', 't',
+		0xc0,
+		0x4b, 'r', 'e', 'c', 'o', 'r', 'd', '_', 's', 'i', 'z', 'e',
+		0xa1, 0x18,
+		0x49, 'l', 'a', 'n', 'g', 'u', 'a', 'g', 'e', 's',
+		0x02, 0x04, 0x42, 'e', 'n', 0x42, 'd', 'e',
+		0x4b, 'd', 'e', 's', 'c', 'r', 'i', 'p', 't', 'i', 'o', 'n',
+		0xe1, 0x42, 'e', 'n', 0x44, 't', 'e', 's', 't',
+	)
+
+	md, err := readMMDBMetadata(buf)
+	if err != nil {
+		t.Fatalf("readMMDBMetadata() error = %v", err)
+	}
+
+	want := &mmdbMetadata{
+		DatabaseType: "GeoLite2-Country",
+		Languages:    []string{"en", "de"},
+		Description:  map[string]string{"en": "test"},
+		BuildEpoch:   1600000000,
+		NodeCount:    0,
+		RecordSize:   24,
+	}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("readMMDBMetadata() = %+v, want %+v", md, want)
+	}
+
+	var values []interface{}
+	if err = walkMMDBData(buf, md, func(v interface{}) { values = append(values, v) }); err != nil {
+		t.Fatalf("walkMMDBData() error = %v", err)
+	}
+	if wantValues := []interface{}{"foo", "foo"}; !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("walkMMDBData() = %#v, want %#v", values, wantValues)
+	}
+
+	if _, err = readMMDBMetadata(buf[:len(buf)/2]); err == nil {
+		t.Error("readMMDBMetadata() of a buffer without metadata returned no error")
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/IncSW/geoip2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// countryAliases maps common alternative and native country names to ISO 3166-1 alpha-2 codes
+var countryAliases = map[string]string{
+	"America":                          "US",
+	"U.S.":                             "US",
+	"U.S.A.":                           "US",
+	"UK":                               "GB",
+	"U.K.":                             "GB",
+	"Great Britain":                    "GB",
+	"Britain":                          "GB",
+	"Holland":                          "NL",
+	"Nederland":                        "NL",
+	"Czech Republic":                   "CZ",
+	"Cesko":                            "CZ",
+	"Ivory Coast":                      "CI",
+	"Burma":                            "MM",
+	"Swaziland":                        "SZ",
+	"Macedonia":                        "MK",
+	"Russia":                           "RU",
+	"Rossiya":                          "RU",
+	"Turkey":                           "TR",
+	"Cape Verde":                       "CV",
+	"East Timor":                       "TL",
+	"DRC":                              "CD",
+	"DR Congo":                         "CD",
+	"Democratic Republic of the Congo": "CD",
+	"Congo-Kinshasa":                   "CD",
+	"Congo-Brazzaville":                "CG",
+	"Republic of Korea":                "KR",
+	"Micronesia":                       "FM",
+	"Brunei":                           "BN",
+	"Vatican":                          "VA",
+	"Vatican City":                     "VA",
+	"Holy See":                         "VA",
+	"Palestine":                        "PS",
+	"UAE":                              "AE",
+	"Deutschland":                      "DE",
+	"Allemagne":                        "DE",
+	"Alemania":                         "DE",
+	"Espana":                           "ES",
+	"Brasil":                           "BR",
+	"Osterreich":                       "AT",
+	"Schweiz":                          "CH",
+	"Suisse":                           "CH",
+	"Svizzera":                         "CH",
+	"Italia":                           "IT",
+	"Polska":                           "PL",
+	"Sverige":                          "SE",
+	"Norge":                            "NO",
+	"Danmark":                          "DK",
+	"Suomi":                            "FI",
+	"Eire":                             "IE",
+	"Magyarorszag":                     "HU",
+	"Hrvatska":                         "HR",
+	"Nippon":                           "JP",
+	"Nihon":                            "JP",
+	"Hellas":                           "GR",
+	"Ellada":                           "GR",
+	"Zhongguo":                         "CN",
+}
+
+// continentNames maps continent codes to their English names
+var continentNames = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
+
+var (
+	countriesByAlpha2  map[string]iso3166Country
+	countriesByAlpha3  map[string]iso3166Country
+	countriesByNumeric map[string]iso3166Country
+	countriesByName    map[string]string
+	aliasesByName      map[string]string
+	continentsByName   map[string]string
+)
+
+func init() {
+	countriesByAlpha2 = make(map[string]iso3166Country, len(iso3166Countries))
+	countriesByAlpha3 = make(map[string]iso3166Country, len(iso3166Countries))
+	countriesByNumeric = make(map[string]iso3166Country, len(iso3166Countries))
+	countriesByName = make(map[string]string, len(iso3166Countries)*2)
+	aliasesByName = make(map[string]string, len(countryAliases))
+	continentsByName = make(map[string]string, len(continentNames))
+
+	for _, c := range iso3166Countries {
+		countriesByAlpha2[c.alpha2] = c
+		countriesByAlpha3[c.alpha3] = c
+		countriesByNumeric[c.numeric] = c
+		for _, name := range c.names {
+			countriesByName[normalizeName(name)] = c.alpha2
+		}
+	}
+	for alias, alpha2 := range countryAliases {
+		aliasesByName[normalizeName(alias)] = alpha2
+	}
+	for code, name := range continentNames {
+		continentsByName[normalizeName(name)] = code
+	}
+}
+
+// normalizeName folds a name for comparison: accents are removed, case is folded, apostrophes and periods are
+// dropped, all other punctuation becomes a space, and a leading "the" is ignored.  "Côte d’Ivoire" and
+// "cote d'ivoire" both normalize to "cote divoire".
+func normalizeName(in string) string {
+	var b strings.Builder
+
+	space := false
+	for _, r := range norm.NFD.String(in) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r == '\'' || r == '’' || r == '‘' || r == '`' || r == '´' || r == '.':
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			space = true
+		}
+	}
+
+	return strings.TrimPrefix(b.String(), "the ")
+}
+
+func isDigits(in string) bool {
+	for _, r := range in {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return in != ""
+}
+
+func isLetters(in string) bool {
+	for _, r := range in {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return in != ""
+}
+
+// countryEntry is a whitelist / blacklist country entry resolved to a canonical identifier.  Entries that resolve
+// to no ISO 3166 country keep only their normalized form, and are matched against the names in the database.
+type countryEntry struct {
+	entry      string
+	kind       string
+	isoCode    string
+	geoNameID  uint32
+	normalized string
+}
+
+// resolvedTo returns the canonical identifier of the entry, or an empty string when it did not resolve
+func (ce countryEntry) resolvedTo() string {
+	if ce.geoNameID != 0 {
+		return strconv.FormatUint(uint64(ce.geoNameID), 10)
+	}
+	return ce.isoCode
+}
+
+// normalizedTo returns the canonical identifier of the entry, or its normalized name when it did not resolve
+func (ce countryEntry) normalizedTo() string {
+	if resolved := ce.resolvedTo(); resolved != "" {
+		return resolved
+	}
+	return ce.normalized
+}
+
+// comparedTo returns the database field match compares the entry against, and its value in country
+func (ce countryEntry) comparedTo(country geoip2.Country) (string, string) {
+	switch {
+	case ce.geoNameID != 0:
+		return "geo_name_id", strconv.FormatUint(uint64(country.GeoNameID), 10)
+	case ce.isoCode != "":
+		return "iso_code", country.ISOCode
+	default:
+		return "names", localizedName(country.Names, defaultLocale)
+	}
+}
+
+// resolveCountryEntry resolves ISO 3166-1 alpha-2, alpha-3 and numeric codes, GeoNameIDs, and English or alias
+// country names.  Numbers of up to three digits are ISO numeric codes, longer numbers are GeoNameIDs.
+func resolveCountryEntry(entry string) countryEntry {
+	trimmed := strings.TrimSpace(entry)
+	ce := countryEntry{entry: entry, kind: "country_name", normalized: normalizeName(trimmed)}
+
+	if isDigits(trimmed) {
+		if len(trimmed) <= 3 {
+			n, _ := strconv.Atoi(trimmed)
+			if c, ok := countriesByNumeric[fmt.Sprintf("%03d", n)]; ok {
+				ce.kind, ce.isoCode = "iso_numeric", c.alpha2
+			}
+		} else if id, err := strconv.ParseUint(trimmed, 10, 32); err == nil {
+			ce.kind, ce.geoNameID = "geo_name_id", uint32(id)
+		}
+		return ce
+	}
+
+	if isLetters(trimmed) {
+		upper := strings.ToUpper(trimmed)
+		if c, ok := countriesByAlpha2[upper]; ok && len(upper) == 2 {
+			ce.kind, ce.isoCode = "iso_code", c.alpha2
+			return ce
+		}
+		if c, ok := countriesByAlpha3[upper]; ok && len(upper) == 3 {
+			ce.kind, ce.isoCode = "iso_alpha3", c.alpha2
+			return ce
+		}
+	}
+
+	if alpha2, ok := countriesByName[ce.normalized]; ok {
+		ce.isoCode = alpha2
+	} else if alpha2, ok := aliasesByName[ce.normalized]; ok {
+		ce.kind, ce.isoCode = "country_alias", alpha2
+	}
+
+	return ce
+}
+
+// match reports whether the entry identifies the country, returning the matched type and the database value that
+// matched
+func (ce countryEntry) match(country geoip2.Country) (string, string, bool) {
+	switch {
+	case ce.geoNameID != 0:
+		return ce.kind, strings.TrimSpace(ce.entry), country.GeoNameID == ce.geoNameID
+
+	case ce.isoCode != "":
+		if country.ISOCode != ce.isoCode {
+			return "", "", false
+		}
+		if ce.kind == "country_name" || ce.kind == "country_alias" {
+			if name, ok := matchingName(country.Names, ce.normalized); ok {
+				return ce.kind, name, true
+			}
+		}
+		return ce.kind, country.ISOCode, true
+
+	default:
+		// unresolved entries may still be a code or a localized name known only to the database
+		if country.ISOCode != "" && strings.EqualFold(country.ISOCode, strings.TrimSpace(ce.entry)) {
+			return "iso_code", country.ISOCode, true
+		}
+		if name, ok := matchingName(country.Names, ce.normalized); ok {
+			return ce.kind, name, true
+		}
+		return "", "", false
+	}
+}
+
+// matchingName returns the name, in any locale, whose normalized form equals normalized
+func matchingName(names map[string]string, normalized string) (string, bool) {
+	if normalized == "" {
+		return "", false
+	}
+	for _, name := range names {
+		if normalizeName(name) == normalized {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// continentEntry is a continent entry resolved to a continent code, when possible
+type continentEntry struct {
+	entry      string
+	kind       string
+	code       string
+	normalized string
+}
+
+func resolveContinentEntry(entry string) continentEntry {
+	trimmed := strings.TrimSpace(entry)
+	ce := continentEntry{entry: entry, kind: "continent_name", normalized: normalizeName(trimmed)}
+
+	if _, ok := continentNames[strings.ToUpper(trimmed)]; ok {
+		ce.kind, ce.code = "continent_code", strings.ToUpper(trimmed)
+	} else if code, ok := continentsByName[ce.normalized]; ok {
+		ce.code = code
+	}
+
+	return ce
+}
+
+func (ce continentEntry) normalizedTo() string {
+	if ce.code != "" {
+		return ce.code
+	}
+	return ce.normalized
+}
+
+func (ce continentEntry) comparedTo(continent geoip2.Continent) (string, string) {
+	if ce.code != "" {
+		return "continent_code", continent.Code
+	}
+	return "names", localizedName(continent.Names, defaultLocale)
+}
+
+func (ce continentEntry) match(continent geoip2.Continent) (string, string, bool) {
+	if ce.code != "" {
+		if continent.Code != ce.code {
+			return "", "", false
+		}
+		if ce.kind == "continent_name" {
+			if name, ok := matchingName(continent.Names, ce.normalized); ok {
+				return ce.kind, name, true
+			}
+		}
+		return ce.kind, continent.Code, true
+	}
+	if continent.Code != "" && strings.EqualFold(continent.Code, strings.TrimSpace(ce.entry)) {
+		return "continent_code", continent.Code, true
+	}
+	if name, ok := matchingName(continent.Names, ce.normalized); ok {
+		return ce.kind, name, true
+	}
+	return "", "", false
+}
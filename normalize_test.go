@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Côte d’Ivoire", want: "cote divoire"},
+		{in: "cote d'ivoire", want: "cote divoire"},
+		{in: "  The Netherlands ", want: "netherlands"},
+		{in: "U.S.A.", want: "usa"},
+		{in: "Guinea-Bissau", want: "guinea bissau"},
+		{in: "Österreich", want: "osterreich"},
+		{in: "theland", want: "theland"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeName(tt.in); got != tt.want {
+				t.Errorf("normalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCountryEntry(t *testing.T) {
+	tests := []struct {
+		entry     string
+		kind      string
+		isoCode   string
+		geoNameID uint32
+	}{
+		{entry: "Côte d’Ivoire", kind: "country_name", isoCode: "CI"},
+		{entry: "cote d'ivoire", kind: "country_name", isoCode: "CI"},
+		{entry: "Ivory Coast", kind: "country_alias", isoCode: "CI"},
+		{entry: "the Netherlands", kind: "country_name", isoCode: "NL"},
+		{entry: "Holland", kind: "country_alias", isoCode: "NL"},
+		{entry: "840", kind: "iso_numeric", isoCode: "US"},
+		{entry: "36", kind: "iso_numeric", isoCode: "AU"},
+		{entry: "USA", kind: "iso_alpha3", isoCode: "US"},
+		{entry: "usa", kind: "iso_alpha3", isoCode: "US"},
+		{entry: "US", kind: "iso_code", isoCode: "US"},
+		{entry: "AS", kind: "iso_code", isoCode: "AS"},
+		{entry: " de ", kind: "iso_code", isoCode: "DE"},
+		{entry: "6252001", kind: "geo_name_id", geoNameID: 6252001},
+		{entry: "999", kind: "country_name"},
+		{entry: "Atlantis", kind: "country_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			ce := resolveCountryEntry(tt.entry)
+			if ce.kind != tt.kind || ce.isoCode != tt.isoCode || ce.geoNameID != tt.geoNameID {
+				t.Errorf("resolveCountryEntry(%q) = {kind: %q, isoCode: %q, geoNameID: %d}, want {kind: %q, isoCode: %q, geoNameID: %d}",
+					tt.entry, ce.kind, ce.isoCode, ce.geoNameID, tt.kind, tt.isoCode, tt.geoNameID)
+			}
+		})
+	}
+}
+
+// TestCountryOrContinentEntry checks that "AS" is American Samoa unless it carries the "continent:" prefix
+func TestCountryOrContinentEntry(t *testing.T) {
+	tests := []struct {
+		entry     string
+		continent bool
+		kind      string
+		code      string
+	}{
+		{entry: "AS", kind: "iso_code", code: "AS"},
+		{entry: "American Samoa", kind: "country_name", code: "AS"},
+		{entry: "country:AS", kind: "iso_code", code: "AS"},
+		{entry: "continent:AS", continent: true, kind: "continent_code", code: "AS"},
+		{entry: "Continent: as", continent: true, kind: "continent_code", code: "AS"},
+		{entry: "continent:Asia", continent: true, kind: "continent_name", code: "AS"},
+		{entry: "continent:north america", continent: true, kind: "continent_name", code: "NA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			value, continent := parseCountryEntry(tt.entry)
+			if continent != tt.continent {
+				t.Fatalf("parseCountryEntry(%q) continent = %t, want %t", tt.entry, continent, tt.continent)
+			}
+
+			var kind, code string
+			if continent {
+				ce := resolveContinentEntry(value)
+				kind, code = ce.kind, ce.code
+			} else {
+				ce := resolveCountryEntry(value)
+				kind, code = ce.kind, ce.isoCode
+			}
+			if kind != tt.kind || code != tt.code {
+				t.Errorf("entry %q resolved to {kind: %q, code: %q}, want {kind: %q, code: %q}", tt.entry, kind, code, tt.kind, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/IncSW/geoip2"
+	"github.com/rs/zerolog"
+)
+
+var policyIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+const (
+	continentEntryPrefix = "continent:"
+	countryEntryPrefix   = "country:"
+)
+
+type PolicyRules struct {
+	Countries  []string `json:"countries,omitempty" description:"Country names, ISO codes or GeoNameIDs.  Entries prefixed with \"continent:\" are treated as continents."`
+	Continents []string `json:"continents,omitempty" description:"Continent codes (e.g. \"EU\", \"AS\") or names (e.g. \"Europe\")."`
+	ASNs       []string `json:"asns,omitempty"`
+	CIDRs      []string `json:"cidrs,omitempty"`
+}
+
+func (r PolicyRules) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Strs("countries", r.Countries)
+	ev.Strs("continents", r.Continents)
+	ev.Strs("asns", r.ASNs)
+	ev.Strs("cidrs", r.CIDRs)
+}
+
+func (r PolicyRules) empty() bool {
+	return len(r.Countries) == 0 && len(r.Continents) == 0 && len(r.ASNs) == 0 && len(r.CIDRs) == 0
+}
+
+func (r PolicyRules) needsCountry() bool {
+	return len(r.Countries) > 0 || len(r.Continents) > 0
+}
+
+// Policy is a named set of allow / deny rules stored on the server.  Deny rules take precedence over allow rules,
+// exactly as blacklist entries do over whitelist entries in a LookupRequest.
+type Policy struct {
+	ID                string      `json:"id"`
+	Description       string      `json:"description,omitempty"`
+	MinimumConfidence *uint16     `json:"minimum_confidence,omitempty"`
+	RejectAnonymous   []string    `json:"reject_anonymous,omitempty"`
+	MatchOn           string      `json:"match_on,omitempty" enum:"located|registered|represented|any"`
+	Fallback          []string    `json:"fallback,omitempty" description:"Countries tried in order when matching country entries, the first one the database knows is used"`
+	DefaultDecision   string      `json:"default_decision,omitempty" description:"Decision for Source IPs the database has no country for, or does not know at all" enum:"allowed|denied"`
+	SpecialAddresses  string      `json:"special_addresses,omitempty" description:"Whether private, loopback, link-local, CGNAT, multicast, documentation and bogon addresses are allowed, defaults to \"deny\"" enum:"allow|deny"`
+	Allow             PolicyRules `json:"allow"`
+	Deny              PolicyRules `json:"deny"`
+}
+
+func (p Policy) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Str("id", p.ID)
+	ev.Object("allow", p.Allow)
+	ev.Object("deny", p.Deny)
+}
+
+func (p Policy) validate() error {
+	if !policyIDRegex.MatchString(p.ID) {
+		return LookupError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid policy id %q, must match %s", p.ID, policyIDRegex.String()),
+		}
+	}
+	if p.Allow.empty() && p.Deny.empty() {
+		return LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "Policy must define at least one \"allow\" or \"deny\" rule",
+		}
+	}
+	for _, cidr := range append(append([]string{}, p.Allow.CIDRs...), p.Deny.CIDRs...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return LookupError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid cidr %q", cidr),
+				Err:     err,
+			}
+		}
+	}
+	if err := validateMatchOn(p.MatchOn); err != nil {
+		return err
+	}
+	if err := validateSpecialAddresses(p.SpecialAddresses); err != nil {
+		return err
+	}
+	if err := validateFallback(p.Fallback, p.MatchOn); err != nil {
+		return err
+	}
+	if err := validateDefaultDecision(p.DefaultDecision); err != nil {
+		return err
+	}
+	return validateAnonymousFlags(p.RejectAnonymous)
+}
+
+// parseCountryEntry strips any "continent:" or "country:" prefix from a country list entry.  Because continent and
+// country codes overlap ("AS" is both Asia and American Samoa), unprefixed entries are always countries.
+func parseCountryEntry(entry string) (string, bool) {
+	if len(entry) > len(continentEntryPrefix) && strings.EqualFold(entry[:len(continentEntryPrefix)], continentEntryPrefix) {
+		return strings.TrimSpace(entry[len(continentEntryPrefix):]), true
+	}
+	if len(entry) > len(countryEntryPrefix) && strings.EqualFold(entry[:len(countryEntryPrefix)], countryEntryPrefix) {
+		return strings.TrimSpace(entry[len(countryEntryPrefix):]), false
+	}
+	return entry, false
+}
+
+// splitCountryEntries separates "continent:" prefixed entries from country entries
+func splitCountryEntries(entries []string) ([]string, []string) {
+	countries := make([]string, 0, len(entries))
+	continents := make([]string, 0)
+	for _, entry := range entries {
+		if value, continent := parseCountryEntry(entry); continent {
+			continents = append(continents, value)
+		} else {
+			countries = append(countries, value)
+		}
+	}
+	return countries, continents
+}
+
+// matchContinent matches the continent of the located country.  The database records no continent for registered
+// or represented countries, so nothing matches when matchOn selects only one of those.
+func matchContinent(lookup *geoip2.CountryResult, targets []string, minimumConfidence *uint16, matchOn string, lt listTrace) LookupResult {
+	res := make(LookupResult, 0)
+
+	if matchOn != "" && matchOn != MatchOnLocated && matchOn != MatchOnAny {
+		for _, target := range uniqueStrings(targets) {
+			lt.add(TraceStep{Rule: "continent", Entry: target, Detail: fmt.Sprintf("Continents are not compared when match_on is %q", matchOn)})
+		}
+		return res
+	}
+
+	if lookup.Continent.Code == "" && len(lookup.Continent.Names) == 0 {
+		for _, target := range uniqueStrings(targets) {
+			lt.add(TraceStep{Rule: "continent", Entry: target, Detail: "Source IP has no continent in the database"})
+		}
+		return res
+	}
+
+	filtered := minimumConfidence != nil && lookup.Country.Confidence < *minimumConfidence
+
+	for _, target := range uniqueStrings(targets) {
+		ce := resolveContinentEntry(target)
+		if lt.enabled() {
+			comparedType, comparedAgainst := ce.comparedTo(lookup.Continent)
+			step := TraceStep{
+				Rule:                 "continent",
+				Entry:                ce.entry,
+				NormalizedTo:         ce.normalizedTo(),
+				ComparedOn:           MatchOnLocated,
+				ComparedType:         comparedType,
+				ComparedAgainst:      comparedAgainst,
+				FilteredByConfidence: filtered,
+				Confidence:           lookup.Country.Confidence,
+			}
+			if !filtered {
+				step.MatchedType, _, step.Matched = ce.match(lookup.Continent)
+			}
+			lt.add(step)
+		}
+		if filtered {
+			continue
+		}
+		matchedType, matchedValue, ok := ce.match(lookup.Continent)
+		if !ok {
+			continue
+		}
+		resolvedTo := ce.code
+		if resolvedTo == "" {
+			resolvedTo = lookup.Continent.Code
+		}
+		res = append(res, LookupMatch{
+			GeoNameID:    lookup.Continent.GeoNameID,
+			MatchedType:  matchedType,
+			MatchedValue: matchedValue,
+			Confidence:   lookup.Country.Confidence,
+			MatchedOn:    MatchOnLocated,
+			Entry:        ce.entry,
+			ResolvedTo:   resolvedTo,
+		})
+	}
+
+	return res
+}
+
+func matchCIDR(ip net.IP, targets []string, lt listTrace) LookupResult {
+	res := make(LookupResult, 0)
+
+	for _, target := range uniqueStrings(targets) {
+		_, ipNet, err := net.ParseCIDR(target)
+		matched := err == nil && ipNet.Contains(ip)
+		step := TraceStep{Rule: "cidr", Entry: target, ComparedType: "source_ip", ComparedAgainst: ip.String(), Matched: matched}
+		if err == nil {
+			step.NormalizedTo = ipNet.String()
+		}
+		if matched {
+			step.MatchedType = "cidr"
+		}
+		lt.add(step)
+
+		if matched {
+			res = append(res, LookupMatch{
+				MatchedType:  "cidr",
+				MatchedValue: target,
+			})
+		}
+	}
+
+	return res
+}
+
+// policyStore keeps policies in memory, persisting each one as a json file in dir
+type policyStore struct {
+	mu       sync.RWMutex
+	dir      string
+	policies map[string]Policy
+}
+
+func (ps *policyStore) policyFilepath(id string) string {
+	return filepath.Join(ps.dir, fmt.Sprintf("%s.json", id))
+}
+
+// load replaces the stored policies with those read from the policy dir.  It must complete before requests are
+// served, or lookups and deletes of policies not read yet would fail.
+func (ps *policyStore) load(log zerolog.Logger) error {
+	if err := os.MkdirAll(ps.dir, 0755); err != nil {
+		return fmt.Errorf("error creating policy dir %q: %w", ps.dir, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(ps.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("error listing policy dir %q: %w", ps.dir, err)
+	}
+
+	policies := make(map[string]Policy, len(files))
+	for _, file := range files {
+		var p Policy
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Error().Err(err).Str("policy-file", file).Msg("Error reading policy file")
+			continue
+		}
+		if err = json.Unmarshal(b, &p); err != nil {
+			log.Error().Err(err).Str("policy-file", file).Msg("Error decoding policy file")
+			continue
+		}
+		if err = p.validate(); err != nil {
+			log.Error().Err(err).Str("policy-file", file).Msg("Policy file is invalid")
+			continue
+		}
+		if ps.policyFilepath(p.ID) != file {
+			log.Error().Str("policy-file", file).Str("id", p.ID).Msg("Policy id does not match its filename")
+			continue
+		}
+		policies[p.ID] = p
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.policies = policies
+
+	log.Info().Int("count", len(ps.policies)).Str("policy-dir", ps.dir).Msg("Policies loaded")
+
+	return nil
+}
+
+func (ps *policyStore) get(id string) (Policy, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	p, ok := ps.policies[id]
+	return p, ok
+}
+
+func (ps *policyStore) list() []Policy {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	out := make([]Policy, 0, len(ps.policies))
+	for _, p := range ps.policies {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// put validates and persists a policy, replacing any existing policy with the same id
+func (ps *policyStore) put(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err = writeFileAtomic(ps.policyFilepath(p.ID), b, 0644); err != nil {
+		return fmt.Errorf("error writing policy %q: %w", p.ID, err)
+	}
+
+	if ps.policies == nil {
+		ps.policies = make(map[string]Policy)
+	}
+	ps.policies[p.ID] = p
+
+	return nil
+}
+
+func (ps *policyStore) delete(id string) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := ps.policies[id]; !ok {
+		return false, nil
+	}
+	if err := os.Remove(ps.policyFilepath(id)); err != nil && !os.IsNotExist(err) {
+		return true, fmt.Errorf("error removing policy %q: %w", id, err)
+	}
+	delete(ps.policies, id)
+
+	return true, nil
+}
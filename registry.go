@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IncSW/geoip2"
+)
+
+var (
+	countryDatabaseTypes        = []string{"GeoIP2-Country", "GeoLite2-Country"}
+	cityDatabaseTypes           = []string{"GeoIP2-City", "GeoLite2-City", "GeoIP2-Enterprise"}
+	asnDatabaseTypes            = []string{"GeoLite2-ASN"}
+	anonymousIPDatabaseTypes    = []string{"GeoIP2-Anonymous-IP"}
+	ispDatabaseTypes            = []string{"GeoIP2-ISP"}
+	connectionTypeDatabaseTypes = []string{"GeoIP2-Connection-Type"}
+	domainDatabaseTypes         = []string{"GeoIP2-Domain"}
+)
+
+// knownDatabaseType returns true when editionID names one of the supported database types
+func knownDatabaseType(editionID string) bool {
+	for _, dbTypes := range [][]string{
+		countryDatabaseTypes,
+		cityDatabaseTypes,
+		asnDatabaseTypes,
+		anonymousIPDatabaseTypes,
+		ispDatabaseTypes,
+		connectionTypeDatabaseTypes,
+		domainDatabaseTypes,
+	} {
+		for _, dbType := range dbTypes {
+			if editionID == dbType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EditionNotLoadedError is returned by the reader registry when no reader is loaded for the requested edition or
+// database type.
+type EditionNotLoadedError struct {
+	EditionID     string
+	DatabaseTypes []string
+}
+
+func (e EditionNotLoadedError) Error() string {
+	if e.EditionID != "" {
+		return fmt.Sprintf("edition %q is not loaded", e.EditionID)
+	}
+	return fmt.Sprintf("no %s edition is loaded", strings.Join(e.DatabaseTypes, " or "))
+}
+
+// EditionNotConfiguredError is returned by the reader registry when none of the configured EditionIDs can be of
+// the requested database types, so no reader for them will ever be loaded.
+type EditionNotConfiguredError struct {
+	DatabaseTypes []string
+}
+
+func (e EditionNotConfiguredError) Error() string {
+	return fmt.Sprintf("a %s edition must be configured", strings.Join(e.DatabaseTypes, " or "))
+}
+
+// editionReader is an immutable, opened edition.  The reader field holds one of the geoip2 reader types, chosen
+// by the database_type found in the mmdb metadata.  The country catalog is built from buf on first use, and shared
+// by readers of the same build.
+type editionReader struct {
+	editionID string
+	metadata  *mmdbMetadata
+	loadedAt  time.Time
+	buf       []byte
+	reader    interface{}
+	catalog   *catalogCache
+}
+
+func (er *editionReader) isType(dbTypes ...string) bool {
+	for _, dbType := range dbTypes {
+		if er.metadata.DatabaseType == dbType {
+			return true
+		}
+	}
+	return false
+}
+
+func openEditionReader(editionID, filename string) (*editionReader, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	er := &editionReader{
+		editionID: editionID,
+		loadedAt:  time.Now(),
+		buf:       buf,
+		catalog:   new(catalogCache),
+	}
+
+	if er.metadata, err = readMMDBMetadata(buf); err != nil {
+		return nil, fmt.Errorf("error reading metadata for %s: %w", editionID, err)
+	}
+
+	switch {
+	case er.isType(countryDatabaseTypes...):
+		er.reader, err = geoip2.NewCountryReader(buf)
+	case er.isType(cityDatabaseTypes...):
+		er.reader, err = geoip2.NewCityReader(buf)
+	case er.isType(asnDatabaseTypes...):
+		er.reader, err = geoip2.NewASNReader(buf)
+	case er.isType(anonymousIPDatabaseTypes...):
+		er.reader, err = geoip2.NewAnonymousIPReader(buf)
+	case er.isType(ispDatabaseTypes...):
+		er.reader, err = geoip2.NewISPReader(buf)
+	case er.isType(connectionTypeDatabaseTypes...):
+		er.reader, err = geoip2.NewConnectionTypeReader(buf)
+	case er.isType(domainDatabaseTypes...):
+		er.reader, err = geoip2.NewDomainReader(buf)
+	default:
+		return nil, fmt.Errorf("edition %s has unsupported database type %q", editionID, er.metadata.DatabaseType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", editionID, err)
+	}
+
+	return er, nil
+}
+
+// readerRegistry holds the currently loaded reader for each configured edition.  The readers map is never modified
+// in place, each swap replaces it wholesale so a snapshot may be used without holding the lock.
+type readerRegistry struct {
+	mu         sync.RWMutex
+	editionIDs []string
+	readers    map[string]*editionReader
+}
+
+func (r *readerRegistry) configure(editionIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.editionIDs = editionIDs
+	r.readers = make(map[string]*editionReader)
+}
+
+// swap atomically replaces the reader for a single edition.  A reader of the same build as the one it replaces
+// keeps the existing country catalog.
+func (r *readerRegistry) swap(er *editionReader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.readers[er.editionID]; ok && old.metadata.DatabaseType == er.metadata.DatabaseType && old.metadata.BuildEpoch == er.metadata.BuildEpoch {
+		er.catalog = old.catalog
+	}
+	readers := make(map[string]*editionReader, len(r.readers)+1)
+	for k, v := range r.readers {
+		readers[k] = v
+	}
+	readers[er.editionID] = er
+	r.readers = readers
+}
+
+func (r *readerRegistry) snapshot() *readerSnapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &readerSnapshot{
+		editionIDs: r.editionIDs,
+		readers:    r.readers,
+	}
+}
+
+// readerSnapshot is a point-in-time view of the registry
+type readerSnapshot struct {
+	editionIDs []string
+	readers    map[string]*editionReader
+}
+
+// configured returns true when the edition is one of the configured EditionIDs, whether or not it is loaded
+func (s *readerSnapshot) configured(editionID string) bool {
+	for _, configured := range s.editionIDs {
+		if configured == editionID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *readerSnapshot) edition(editionID string) (*editionReader, error) {
+	if er, ok := s.readers[editionID]; ok {
+		return er, nil
+	}
+	return nil, EditionNotLoadedError{EditionID: editionID}
+}
+
+// typeConfigured returns true when a configured edition is, or once loaded may be, one of the provided database
+// types.  The type of an edition is only known once it is loaded, until then MaxMind edition IDs are assumed to
+// name their database type, and edition IDs naming no supported type may be any of them.
+func (s *readerSnapshot) typeConfigured(dbTypes ...string) bool {
+	for _, editionID := range s.editionIDs {
+		if er, ok := s.readers[editionID]; ok {
+			if er.isType(dbTypes...) {
+				return true
+			}
+			continue
+		}
+		if !knownDatabaseType(editionID) {
+			return true
+		}
+		for _, dbType := range dbTypes {
+			if editionID == dbType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// byType returns the first loaded edition, in configuration order, with one of the provided database types
+func (s *readerSnapshot) byType(dbTypes ...string) (*editionReader, error) {
+	for _, editionID := range s.editionIDs {
+		if er, ok := s.readers[editionID]; ok && er.isType(dbTypes...) {
+			return er, nil
+		}
+	}
+	if !s.typeConfigured(dbTypes...) {
+		return nil, EditionNotConfiguredError{DatabaseTypes: dbTypes}
+	}
+	return nil, EditionNotLoadedError{DatabaseTypes: dbTypes}
+}
+
+func (s *readerSnapshot) city() (*geoip2.CityReader, error) {
+	er, err := s.byType(cityDatabaseTypes...)
+	if err != nil {
+		return nil, err
+	}
+	return er.reader.(*geoip2.CityReader), nil
+}
+
+func (s *readerSnapshot) asn() (*geoip2.ASNReader, error) {
+	er, err := s.byType(asnDatabaseTypes...)
+	if err != nil {
+		return nil, err
+	}
+	return er.reader.(*geoip2.ASNReader), nil
+}
+
+func (s *readerSnapshot) anonymousIP() (*geoip2.AnonymousIPReader, error) {
+	er, err := s.byType(anonymousIPDatabaseTypes...)
+	if err != nil {
+		return nil, err
+	}
+	return er.reader.(*geoip2.AnonymousIPReader), nil
+}
+
+// countryEdition returns the edition country lookups are answered from, preferring a country edition and falling
+// back to a city edition
+func (s *readerSnapshot) countryEdition() (*editionReader, error) {
+	if er, err := s.byType(countryDatabaseTypes...); err == nil {
+		return er, nil
+	}
+	if er, err := s.byType(cityDatabaseTypes...); err == nil {
+		return er, nil
+	}
+	dbTypes := append(append([]string{}, countryDatabaseTypes...), cityDatabaseTypes...)
+	if !s.typeConfigured(dbTypes...) {
+		return nil, EditionNotConfiguredError{DatabaseTypes: dbTypes}
+	}
+	return nil, EditionNotLoadedError{DatabaseTypes: dbTypes}
+}
+
+// countryLookup uses a country edition when one is loaded, falling back to a city edition
+func (s *readerSnapshot) countryLookup(ip net.IP) (*geoip2.CountryResult, error) {
+	er, err := s.countryEdition()
+	if err != nil {
+		return nil, err
+	}
+
+	if cr, ok := er.reader.(*geoip2.CountryReader); ok {
+		return cr.Lookup(ip)
+	}
+
+	lookup, err := er.reader.(*geoip2.CityReader).Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geoip2.CountryResult{
+		Continent:          lookup.Continent,
+		Country:            lookup.Country,
+		RegisteredCountry:  lookup.RegisteredCountry,
+		RepresentedCountry: lookup.RepresentedCountry,
+		Traits:             lookup.Traits,
+	}, nil
+}
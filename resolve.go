@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	maxResolveSuggestions = 5
+	minSuggestionScore    = 0.5
+
+	// maxResolveEntryLength bounds the bytes of a single entry, as unresolved entries are compared against every name
+	// in the catalog
+	maxResolveEntryLength = 64
+	// resolveBodyPerEntry is the request body allowed per entry, room for a fully escaped entry of the maximum length
+	resolveBodyPerEntry = 1024
+)
+
+type CountryResolveRequest struct {
+	Entries []string `json:"entries" description:"Country list entries exactly as they would be sent in whitelist_countries, including \"continent:\" prefixed entries"`
+	Locale  string   `json:"locale,omitempty" description:"Locale of returned names, defaults to the request's Accept-Language header, falling back to English"`
+}
+
+func (r CountryResolveRequest) MarshalZerologObject(ev *zerolog.Event) {
+	ev.Strs("entries", r.Entries)
+	ev.Str("locale", r.Locale)
+}
+
+type CountrySuggestion struct {
+	ResolvedTo string  `json:"resolved_to"`
+	Name       string  `json:"name"`
+	Score      float64 `json:"score"`
+}
+
+// CountryResolution describes what a single entry resolved to.  Entries that did not resolve carry suggestions
+// drawn from the names in the loaded database, best first.
+type CountryResolution struct {
+	Entry       string              `json:"entry"`
+	Type        string              `json:"type" enum:"country|continent"`
+	Resolved    bool                `json:"resolved"`
+	MatchedType string              `json:"matched_type,omitempty"`
+	ResolvedTo  string              `json:"resolved_to,omitempty"`
+	GeoNameID   uint32              `json:"geo_name_id,omitempty"`
+	Name        string              `json:"name,omitempty"`
+	Suggestions []CountrySuggestion `json:"suggestions,omitempty"`
+}
+
+type CountryResolveResult struct {
+	Locale   string              `json:"locale"`
+	Database *DatabaseInfo       `json:"database"`
+	Results  []CountryResolution `json:"results"`
+}
+
+// levenshtein returns the edit distance between two strings, counted in runes
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = cur[j-1] + 1
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// similarity scores two normalized names between 0 and 1, where 1 is identical
+func similarity(a, b string) float64 {
+	la, lb := len([]rune(a)), len([]rune(b))
+	longest := la
+	if lb > longest {
+		longest = lb
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// suggest scores the entry against every name of every candidate, in any locale, keeping each candidate's best
+// score
+func suggest(normalized string, candidates map[string]map[string]string, locale string) []CountrySuggestion {
+	out := make([]CountrySuggestion, 0)
+	if normalized == "" {
+		return out
+	}
+
+	for id, names := range candidates {
+		best := 0.0
+		for _, name := range names {
+			if score := similarity(normalized, normalizeName(name)); score > best {
+				best = score
+			}
+		}
+		if best >= minSuggestionScore {
+			out = append(out, CountrySuggestion{
+				ResolvedTo: id,
+				Name:       localizedName(names, locale),
+				Score:      float64(int(best*1000)) / 1000,
+			})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score == out[j].Score {
+			return out[i].ResolvedTo < out[j].ResolvedTo
+		}
+		return out[i].Score > out[j].Score
+	})
+	if len(out) > maxResolveSuggestions {
+		out = out[:maxResolveSuggestions]
+	}
+
+	return out
+}
+
+func resolveCountry(cat *countryCatalog, entry, value, locale string) CountryResolution {
+	res := CountryResolution{Entry: entry, Type: "country"}
+	ce := resolveCountryEntry(value)
+
+	var cc *catalogCountry
+	switch {
+	case ce.geoNameID != 0:
+		cc, _ = cat.countryByGeoNameID(ce.geoNameID)
+	case ce.isoCode != "":
+		cc = cat.countries[ce.isoCode]
+		if cc == nil {
+			// a valid ISO 3166 country the database does not name
+			res.Resolved, res.MatchedType, res.ResolvedTo = true, ce.kind, ce.isoCode
+			res.Name = countriesByAlpha2[ce.isoCode].names[0]
+			return res
+		}
+	default:
+		for _, candidate := range cat.countries {
+			if _, matchedValue, ok := ce.match(geoip2Country(candidate)); ok {
+				cc = candidate
+				res.MatchedType = "country_name"
+				if matchedValue == candidate.ISOCode {
+					res.MatchedType = "iso_code"
+				}
+				break
+			}
+		}
+	}
+
+	if cc == nil {
+		candidates := make(map[string]map[string]string, len(cat.countries))
+		for iso, candidate := range cat.countries {
+			candidates[iso] = candidate.Names
+		}
+		res.Suggestions = suggest(ce.normalized, candidates, locale)
+		return res
+	}
+
+	res.Resolved = true
+	if res.MatchedType == "" {
+		res.MatchedType = ce.kind
+	}
+	res.ResolvedTo = cc.ISOCode
+	if ce.geoNameID != 0 {
+		res.ResolvedTo = strconv.FormatUint(uint64(ce.geoNameID), 10)
+	}
+	res.GeoNameID = cc.GeoNameID
+	res.Name = localizedName(cc.Names, locale)
+
+	return res
+}
+
+func resolveContinent(cat *countryCatalog, entry, value, locale string) CountryResolution {
+	res := CountryResolution{Entry: entry, Type: "continent"}
+	ce := resolveContinentEntry(value)
+
+	var cc *catalogContinent
+	if ce.code != "" {
+		cc = cat.continents[ce.code]
+		if cc == nil {
+			res.Resolved, res.MatchedType, res.ResolvedTo, res.Name = true, ce.kind, ce.code, continentNames[ce.code]
+			return res
+		}
+	} else {
+		for _, candidate := range cat.continents {
+			if _, _, ok := ce.match(geoip2Continent(candidate)); ok {
+				cc = candidate
+				break
+			}
+		}
+	}
+
+	if cc == nil {
+		candidates := make(map[string]map[string]string, len(cat.continents))
+		for code, candidate := range cat.continents {
+			candidates[code] = candidate.Names
+		}
+		res.Suggestions = suggest(ce.normalized, candidates, locale)
+		return res
+	}
+
+	res.Resolved = true
+	res.MatchedType = ce.kind
+	res.ResolvedTo = cc.Code
+	res.GeoNameID = cc.GeoNameID
+	res.Name = localizedName(cc.Names, locale)
+
+	return res
+}
+
+func (g *geoman) resolveCountries(req CountryResolveRequest) (*CountryResolveResult, error) {
+	g.log.Info().Object("request", req).Msg("Handling country resolve request...")
+
+	if len(req.Entries) == 0 {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "\"entries\" must be provided",
+		}
+	}
+
+	// each unresolved entry is compared against every name of every country, so both the number and the length of
+	// entries are bounded
+	if len(req.Entries) > g.maxResolveEntries {
+		return nil, LookupError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request contains %d entries, the maximum is %d", len(req.Entries), g.maxResolveEntries),
+		}
+	}
+	for i, entry := range req.Entries {
+		if len(entry) > maxResolveEntryLength {
+			return nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Entry %d is %d bytes long, entries are limited to %d bytes", i, len(entry), maxResolveEntryLength),
+			}
+		}
+	}
+
+	er, err := g.registry.snapshot().countryEdition()
+	if err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	cat, err := er.countryCatalog()
+	if err != nil {
+		return nil, readerLookupError(err)
+	}
+
+	res := &CountryResolveResult{
+		Locale:   negotiateLocale(req.Locale, er.metadata.Languages),
+		Database: newDatabaseInfo(er),
+		Results:  make([]CountryResolution, len(req.Entries)),
+	}
+
+	for i, entry := range req.Entries {
+		if value, continent := parseCountryEntry(entry); continent {
+			res.Results[i] = resolveContinent(cat, entry, value, res.Locale)
+		} else {
+			res.Results[i] = resolveCountry(cat, entry, value, res.Locale)
+		}
+	}
+
+	return res, nil
+}
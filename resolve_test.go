@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGeomanResolveCountriesLimits(t *testing.T) {
+	g := newTestGeoman(t, []string{"GeoLite2-Country"}, map[string][]byte{
+		"GeoLite2-Country": buildTestMMDB(t, "GeoLite2-Country", testCountryNetworks),
+	})
+	g.maxResolveEntries = 2
+
+	tests := []struct {
+		name     string
+		entries  []string
+		wantCode int
+	}{
+		{name: "within limits", entries: []string{"US", strings.Repeat("x", maxResolveEntryLength)}},
+		{name: "too many entries", entries: []string{"US", "DE", "FR"}, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "entry too long", entries: []string{"US", strings.Repeat("x", maxResolveEntryLength+1)}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := g.resolveCountries(CountryResolveRequest{Entries: tt.entries})
+			if tt.wantCode != 0 {
+				var lerr LookupError
+				if !errors.As(err, &lerr) || lerr.Code != tt.wantCode {
+					t.Fatalf("resolveCountries() error = %v, want code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveCountries() error = %v", err)
+			}
+			if len(res.Results) != len(tt.entries) {
+				t.Errorf("resolveCountries() returned %d results, want %d", len(res.Results), len(tt.entries))
+			}
+		})
+	}
+}
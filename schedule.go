@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// updateStateFilename is the name of the file, in the database directory, recording the last successful download
+// of each edition
+const updateStateFilename = "gipman-updates.json"
+
+// updateSchedule decides when databases are next downloaded: at the times matching cron when set, otherwise once
+// update interval has passed since the last successful download.  Each scheduled update is delayed by a random
+// duration of up to jitter, so that many instances do not all download at once.
+type updateSchedule struct {
+	cron     *cronSchedule
+	interval time.Duration
+	location *time.Location
+	jitter   time.Duration
+	rand     *rand.Rand
+}
+
+func newUpdateSchedule(expr, timezone string, interval, jitter time.Duration) (*updateSchedule, error) {
+	var err error
+
+	s := &updateSchedule{
+		interval: interval,
+		jitter:   jitter,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if s.location, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("provided update timezone %q is not valid: %w", timezone, err)
+	}
+
+	if jitter < 0 {
+		return nil, fmt.Errorf("provided update jitter %s must not be negative", jitter)
+	}
+
+	if expr != "" {
+		if s.cron, err = parseCron(expr); err != nil {
+			return nil, fmt.Errorf("provided update schedule is not valid: %w", err)
+		}
+		if s.cron.next(time.Now().In(s.location)).IsZero() {
+			return nil, fmt.Errorf("provided update schedule %q never matches", expr)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *updateSchedule) String() string {
+	if s.cron != nil {
+		return fmt.Sprintf("%s (%s)", s.cron, s.location)
+	}
+	return fmt.Sprintf("every %s", s.interval)
+}
+
+// due returns when the next update is due, given the time of the last one.  Without a last update the databases
+// are stale and the update is due immediately.
+func (s *updateSchedule) due(last time.Time) time.Time {
+	if last.IsZero() {
+		return last
+	}
+	if s.cron != nil {
+		return s.cron.next(last.In(s.location))
+	}
+	return last.Add(s.interval)
+}
+
+// wait returns how long to wait for the update due at due.  Overdue updates run immediately, others are delayed by
+// the jitter.
+func (s *updateSchedule) wait(due time.Time, now time.Time) time.Duration {
+	d := due.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	if s.jitter > 0 {
+		d += time.Duration(s.rand.Int63n(int64(s.jitter)))
+	}
+	return d
+}
+
+// updateState is persisted in the database directory so that a restart keeps the update schedule
+type updateState struct {
+	mu       sync.Mutex
+	filename string
+	Editions map[string]time.Time `json:"editions"`
+}
+
+func newUpdateState(dbDir string) *updateState {
+	return &updateState{filename: filepath.Join(dbDir, updateStateFilename)}
+}
+
+func (us *updateState) load() error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.Editions = make(map[string]time.Time)
+
+	b, err := ioutil.ReadFile(us.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading update state %q: %w", us.filename, err)
+	}
+
+	if err = json.Unmarshal(b, us); err != nil {
+		return fmt.Errorf("error decoding update state %q: %w", us.filename, err)
+	}
+
+	return nil
+}
+
+// record persists the time of a successful download of the edition
+func (us *updateState) record(editionID string, at time.Time) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if us.Editions == nil {
+		us.Editions = make(map[string]time.Time)
+	}
+	us.Editions[editionID] = at
+
+	b, err := json.MarshalIndent(us, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(us.filename, b, 0644); err != nil {
+		return fmt.Errorf("error writing update state %q: %w", us.filename, err)
+	}
+
+	return nil
+}
+
+// lastUpdate returns when the least recently downloaded of the editions was last downloaded, or the zero time when
+// any of them has never been
+func (us *updateState) lastUpdate(editionIDs []string) time.Time {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	var oldest time.Time
+	for i, editionID := range editionIDs {
+		at, ok := us.Editions[editionID]
+		if !ok {
+			return time.Time{}
+		}
+		if i == 0 || at.Before(oldest) {
+			oldest = at
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Classes of addresses that are never in the geoip databases
+const (
+	AddressClassPrivate       = "private"
+	AddressClassLoopback      = "loopback"
+	AddressClassLinkLocal     = "link_local"
+	AddressClassCGNAT         = "cgnat"
+	AddressClassMulticast     = "multicast"
+	AddressClassDocumentation = "documentation"
+	AddressClassBogon         = "bogon"
+)
+
+// Values accepted by LookupRequest.SpecialAddresses and Policy.SpecialAddresses
+const (
+	SpecialAddressesAllow = "allow"
+	SpecialAddressesDeny  = "deny"
+)
+
+var specialAddressesValues = []string{SpecialAddressesAllow, SpecialAddressesDeny}
+
+type specialNetwork struct {
+	class string
+	ipNet *net.IPNet
+}
+
+// specialNetworks are checked in order, so the more specific reserved ranges come before the catch-all bogons
+var specialNetworks = mustSpecialNetworks(map[string][]string{
+	AddressClassPrivate: {
+		"10.0.0.0/8",     // RFC 1918
+		"172.16.0.0/12",  // RFC 1918
+		"192.168.0.0/16", // RFC 1918
+		"fc00::/7",       // RFC 4193 unique local
+	},
+	AddressClassLoopback: {
+		"127.0.0.0/8", // RFC 1122
+		"::1/128",     // RFC 4291
+	},
+	AddressClassLinkLocal: {
+		"169.254.0.0/16", // RFC 3927
+		"fe80::/10",      // RFC 4291
+	},
+	AddressClassCGNAT: {
+		"100.64.0.0/10", // RFC 6598
+	},
+	AddressClassMulticast: {
+		"224.0.0.0/4", // RFC 5771
+		"ff00::/8",    // RFC 4291
+	},
+	AddressClassDocumentation: {
+		"192.0.2.0/24",    // RFC 5737 TEST-NET-1
+		"198.51.100.0/24", // RFC 5737 TEST-NET-2
+		"203.0.113.0/24",  // RFC 5737 TEST-NET-3
+		"2001:db8::/32",   // RFC 3849
+		"3fff::/20",       // RFC 9637
+	},
+	AddressClassBogon: {
+		"0.0.0.0/8",     // RFC 1122 "this network"
+		"192.0.0.0/24",  // RFC 6890 IETF protocol assignments
+		"198.18.0.0/15", // RFC 2544 benchmarking
+		"240.0.0.0/4",   // RFC 1112 reserved, including the limited broadcast address
+		"::/128",        // RFC 4291 unspecified
+		"100::/64",      // RFC 6666 discard-only
+		"2001:2::/48",   // RFC 5180 benchmarking
+	},
+})
+
+// globalUnicast6 is the only IPv6 range IANA has allocated to the regional registries
+var _, globalUnicast6, _ = net.ParseCIDR("2000::/3")
+
+func mustSpecialNetworks(in map[string][]string) []specialNetwork {
+	out := make([]specialNetwork, 0)
+	for _, class := range []string{
+		AddressClassPrivate,
+		AddressClassLoopback,
+		AddressClassLinkLocal,
+		AddressClassCGNAT,
+		AddressClassMulticast,
+		AddressClassDocumentation,
+		AddressClassBogon,
+	} {
+		for _, cidr := range in[class] {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				panic(fmt.Sprintf("invalid special network %q: %v", cidr, err))
+			}
+			out = append(out, specialNetwork{class: class, ipNet: ipNet})
+		}
+	}
+	return out
+}
+
+// addressClass returns the class of special address ip belongs to, or an empty string for globally routable
+// addresses.  IPv6 addresses outside of 2000::/3 are unallocated, and so are bogons.
+func addressClass(ip net.IP) string {
+	for _, sn := range specialNetworks {
+		if sn.ipNet.Contains(ip) {
+			return sn.class
+		}
+	}
+	if ip.To4() == nil && !globalUnicast6.Contains(ip) {
+		return AddressClassBogon
+	}
+	return ""
+}
+
+// specialDecision decides a special address of the class.  A matching deny or allow cidr decides it as for any other
+// address, otherwise the policy's special addresses setting does.
+func specialDecision(p Policy, class string, allow, deny LookupResult, trace *decisionTrace) *LookupDecision {
+	if len(deny) > 0 {
+		return &LookupDecision{Decision: DecisionDenied, Reason: ReasonDenyMatched, AddressClass: class, Matches: deny, Trace: trace.result()}
+	}
+	if len(allow) > 0 {
+		return &LookupDecision{Decision: DecisionAllowed, Reason: ReasonAllowMatched, AddressClass: class, Matches: allow, Trace: trace.result()}
+	}
+
+	setting, decision := SpecialAddressesDeny, DecisionDenied
+	if p.SpecialAddresses == SpecialAddressesAllow {
+		setting, decision = SpecialAddressesAllow, DecisionAllowed
+	}
+	trace.add(TraceStep{
+		Rule:            "address_class",
+		Entry:           setting,
+		NormalizedTo:    decision,
+		ComparedType:    "address_class",
+		ComparedAgainst: class,
+		Matched:         true,
+		MatchedType:     "address_class",
+	})
+	return &LookupDecision{
+		Decision:     decision,
+		Reason:       ReasonSpecial,
+		AddressClass: class,
+		Matches:      LookupResult{{MatchedType: "address_class", MatchedValue: class}},
+		Trace:        trace.result(),
+	}
+}
+
+func validateSpecialAddresses(in string) error {
+	if in == "" || in == SpecialAddressesAllow || in == SpecialAddressesDeny {
+		return nil
+	}
+	return LookupError{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("Invalid \"special_addresses\" value %q, must be one of %v", in, specialAddressesValues),
+	}
+}
+
+// specialAddressError is returned by lookups that only return geo data, which special addresses never have
+func specialAddressError(ip net.IP, class string) error {
+	return LookupError{
+		Code:    http.StatusUnprocessableEntity,
+		Message: fmt.Sprintf("Source IP %s is a %s address and has no geo data", ip, class),
+	}
+}
+
+// parseSourceIP parses the Source IP of a lookup that only returns geo data, refusing special addresses
+func parseSourceIP(sourceIP string) (net.IP, error) {
+	if sourceIP == "" {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "\"source_ip\" must be provided",
+		}
+	}
+
+	ip := net.ParseIP(sourceIP)
+	if ip == nil {
+		return nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid \"source_ip\" value provided",
+		}
+	}
+
+	if class := addressClass(ip); class != "" {
+		return nil, specialAddressError(ip, class)
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestAddressClass(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.1.2.3", want: AddressClassPrivate},
+		{ip: "172.16.0.1", want: AddressClassPrivate},
+		{ip: "192.168.1.1", want: AddressClassPrivate},
+		{ip: "fd00::1", want: AddressClassPrivate},
+		{ip: "127.0.0.1", want: AddressClassLoopback},
+		{ip: "::1", want: AddressClassLoopback},
+		{ip: "169.254.1.1", want: AddressClassLinkLocal},
+		{ip: "fe80::1", want: AddressClassLinkLocal},
+		{ip: "100.64.0.1", want: AddressClassCGNAT},
+		{ip: "224.0.0.251", want: AddressClassMulticast},
+		{ip: "ff02::1", want: AddressClassMulticast},
+		{ip: "192.0.2.1", want: AddressClassDocumentation},
+		{ip: "2001:db8::1", want: AddressClassDocumentation},
+		{ip: "0.0.0.0", want: AddressClassBogon},
+		{ip: "255.255.255.255", want: AddressClassBogon},
+		{ip: "::", want: AddressClassBogon},
+		{ip: "4000::1", want: AddressClassBogon},
+		{ip: "8.8.8.8", want: ""},
+		{ip: "172.32.0.1", want: ""},
+		{ip: "2001:4860::8888", want: ""},
+		{ip: "::ffff:10.0.0.1", want: AddressClassPrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("invalid test ip %q", tt.ip)
+			}
+			if got := addressClass(ip); got != tt.want {
+				t.Errorf("addressClass(%s) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourceIP(t *testing.T) {
+	tests := []struct {
+		sourceIP string
+		wantCode int
+	}{
+		{sourceIP: "8.8.8.8"},
+		{sourceIP: "2001:4860::8888"},
+		{sourceIP: "", wantCode: http.StatusBadRequest},
+		{sourceIP: "not an ip", wantCode: http.StatusBadRequest},
+		{sourceIP: "10.0.0.1", wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sourceIP, func(t *testing.T) {
+			ip, err := parseSourceIP(tt.sourceIP)
+			if tt.wantCode != 0 {
+				var lerr LookupError
+				if !errors.As(err, &lerr) || lerr.Code != tt.wantCode {
+					t.Fatalf("parseSourceIP(%q) error = %v, want code %d", tt.sourceIP, err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil || !ip.Equal(net.ParseIP(tt.sourceIP)) {
+				t.Errorf("parseSourceIP(%q) = %v, %v", tt.sourceIP, ip, err)
+			}
+		})
+	}
+}
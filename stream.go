@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+
+	// maxStreamLineSize bounds the memory used per line of a streamed lookup.  Longer lines are discarded and
+	// reported as an error record.
+	maxStreamLineSize = 64 * 1024
+)
+
+// StreamLookupItem is a single output record of a streamed lookup, Line is the 1-based input line it answers
+type StreamLookupItem struct {
+	Line int `json:"line"`
+	BatchLookupItem
+}
+
+// readStreamLine returns the next line of r without its trailing newline.  A line longer than the reader's buffer is
+// consumed in full and reported with tooLong set, so the stream can continue at the following line.
+func readStreamLine(r *bufio.Reader) (line []byte, tooLong bool, err error) {
+	for {
+		var chunk []byte
+		chunk, err = r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			tooLong = true
+			continue
+		}
+		if !tooLong {
+			line = bytes.TrimSpace(chunk)
+		}
+		if err == io.EOF && (tooLong || len(chunk) > 0) {
+			err = nil
+		}
+		return
+	}
+}
+
+// lookupStream evaluates each newline delimited LookupRequest read from in, passing one record per non-empty
+// line to emit as soon as it is evaluated.  Lines without a locale use locale.  Only errors reading in or
+// returned by emit end the stream.
+func (g *geoman) lookupStream(in io.Reader, locale string, emit func(StreamLookupItem) error) error {
+	var (
+		lineNum int
+		count   int
+
+		r = bufio.NewReaderSize(in, maxStreamLineSize)
+	)
+
+	g.log.Info().Msg("Handling streamed lookup request...")
+
+	for {
+		line, tooLong, err := readStreamLine(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		lineNum++
+
+		if !tooLong && len(line) == 0 {
+			continue
+		}
+
+		count++
+		item := StreamLookupItem{Line: lineNum}
+
+		if tooLong {
+			item.Error = &LookupError{
+				Code:    http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("Line exceeds the maximum length of %d bytes", maxStreamLineSize),
+			}
+		} else {
+			item.BatchLookupItem = g.streamLookupItem(line, locale)
+		}
+
+		if err = emit(item); err != nil {
+			return err
+		}
+	}
+
+	g.log.Info().Int("lines", lineNum).Int("lookups", count).Msg("Streamed lookup request completed")
+
+	return nil
+}
+
+func (g *geoman) streamLookupItem(line []byte, locale string) BatchLookupItem {
+	var req LookupRequest
+
+	if err := json.Unmarshal(line, &req); err != nil {
+		return BatchLookupItem{Error: &LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "Malformed lookup request",
+			Err:     err,
+		}}
+	}
+
+	item := BatchLookupItem{SourceIP: req.SourceIP}
+
+	if req.Locale == "" {
+		req.Locale = locale
+	}
+
+	p, err := g.requestPolicy(req)
+	if err != nil {
+		item.Error = batchItemError(err)
+		return item
+	}
+
+	if item.Decision, err = g.evaluateWithContext(g.registry.snapshot(), req.SourceIP, p, req.evaluateOptions()); err != nil {
+		item.Error = batchItemError(err)
+	}
+
+	return item
+}
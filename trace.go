@@ -0,0 +1,58 @@
+package main
+
+// TraceStep records a single rule evaluated while deciding on a Source IP.  Steps are numbered in evaluation order.
+type TraceStep struct {
+	Step                 int    `json:"step"`
+	Rule                 string `json:"rule" enum:"address_class|anonymous|cidr|fallback|country|continent|asn|default_decision|degraded"`
+	List                 string `json:"list,omitempty" enum:"allow|deny"`
+	Entry                string `json:"entry,omitempty" description:"The entry as provided in the request or policy"`
+	NormalizedTo         string `json:"normalized_to,omitempty" description:"The canonical identifier or normalized name the entry resolved to"`
+	ComparedOn           string `json:"compared_on,omitempty" enum:"located|registered|represented"`
+	ComparedType         string `json:"compared_type,omitempty" description:"The database field the entry was compared against, e.g. iso_code, geo_name_id or names"`
+	ComparedAgainst      string `json:"compared_against,omitempty" description:"The database value the entry was compared against"`
+	Matched              bool   `json:"matched"`
+	MatchedType          string `json:"matched_type,omitempty"`
+	FilteredByConfidence bool   `json:"filtered_by_confidence,omitempty" description:"The entry was not compared because the record's confidence is below minimum_confidence"`
+	Confidence           uint16 `json:"confidence,omitempty"`
+	Detail               string `json:"detail,omitempty"`
+}
+
+// decisionTrace collects the steps of a single evaluation.  A nil trace records nothing, so matching code may add
+// steps unconditionally.
+type decisionTrace struct {
+	steps []TraceStep
+}
+
+func (t *decisionTrace) add(step TraceStep) {
+	if t == nil {
+		return
+	}
+	step.Step = len(t.steps) + 1
+	t.steps = append(t.steps, step)
+}
+
+func (t *decisionTrace) list(list string) listTrace {
+	return listTrace{trace: t, list: list}
+}
+
+func (t *decisionTrace) result() []TraceStep {
+	if t == nil {
+		return nil
+	}
+	return t.steps
+}
+
+// listTrace adds steps for the entries of a single allow or deny list
+type listTrace struct {
+	trace *decisionTrace
+	list  string
+}
+
+func (lt listTrace) enabled() bool {
+	return lt.trace != nil
+}
+
+func (lt listTrace) add(step TraceStep) {
+	step.List = lt.list
+	lt.trace.add(step)
+}
@@ -0,0 +1,22 @@
+package main
+
+// lookupV2 returns a decision with its reason, matches, the resolved geo record and the database it was answered
+// from.  Unless include names which, both geo and database context are returned when available: an IP absent from
+// the database, or a policy evaluated without any country or city edition loaded, simply has none.  Context named
+// by include is required.  /gipman/decide is a deprecated alias.
+func (g *geoman) lookupV2(req LookupRequest) (*LookupDecision, error) {
+	g.log.Info().Object("request", req).Msg("Handling lookup request...")
+
+	p, err := g.requestPolicy(req)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := req.evaluateOptions()
+	if len(opts.include) == 0 {
+		opts.include = includeValues
+		opts.optionalContext = true
+	}
+
+	return g.evaluateWithContext(g.registry.snapshot(), req.SourceIP, p, opts)
+}
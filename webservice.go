@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/dcarbone/zadapters/zstdlog"
 	"github.com/emicklei/go-restful/v3"
@@ -42,17 +47,24 @@ Example response:
 ]
 `
 
+// Route documentation of the errors returned when a database a request needs is unavailable
+const (
+	msgEditionNotConfigured = "No edition of the database type the request needs is configured"
+	msgEditionNotLoaded     = "The edition the request needs is configured, but not loaded yet"
+)
+
 const envHostname = "GIPMAN_HOSTNAME"
 const envDocRoot = "GIPMAN_DOCROOT"
 
 type webservice struct {
-	log       zerolog.Logger
-	gm        *geoman
-	httpAddr  string
-	container *restful.Container
+	log            zerolog.Logger
+	gm             *geoman
+	httpAddr       string
+	trustedProxies []*net.IPNet
+	container      *restful.Container
 }
 
-func handleResult(response *restful.Response, res LookupResult, err error) {
+func handleResult(response *restful.Response, res interface{}, err error) {
 	if err != nil {
 		if lerr, ok := err.(LookupError); ok {
 			_ = response.WriteHeaderAndEntity(lerr.Code, lerr)
@@ -96,6 +108,533 @@ func (ws *webservice) postLookup(request *restful.Request, response *restful.Res
 	handleResult(response, res, err)
 }
 
+// queryParameterList returns the values of a query parameter that may be repeated, comma separated, or both
+func queryParameterList(request *restful.Request, name string) []string {
+	return splitHeaderList(request.QueryParameters(name))
+}
+
+// getLookup builds a lookup request from query parameters, using the caller's address when no source_ip is given
+func (ws *webservice) getLookup(request *restful.Request, response *restful.Response) {
+	var (
+		res LookupResult
+		err error
+
+		req = LookupRequest{
+			SourceIP:           request.QueryParameter("source_ip"),
+			PolicyID:           request.QueryParameter("policy_id"),
+			WhitelistCountries: queryParameterList(request, "countries"),
+			WhitelistASNs:      queryParameterList(request, "asns"),
+			BlacklistCountries: queryParameterList(request, "blacklist_countries"),
+			BlacklistASNs:      queryParameterList(request, "blacklist_asns"),
+			RejectAnonymous:    queryParameterList(request, "reject_anonymous"),
+			MatchOn:            request.QueryParameter("match_on"),
+			Fallback:           queryParameterList(request, "fallback"),
+			DefaultDecision:    request.QueryParameter("default_decision"),
+			SpecialAddresses:   request.QueryParameter("special_addresses"),
+		}
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if mc := request.QueryParameter("minimum_confidence"); mc != "" {
+		u, err := strconv.ParseUint(mc, 10, 16)
+		if err != nil {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid \"minimum_confidence\" value provided",
+				Err:     err,
+			})
+			return
+		}
+		confidence := uint16(u)
+		req.MinimumConfidence = &confidence
+	}
+
+	if req.SourceIP == "" {
+		ip, err := clientIP(request.Request, ws.trustedProxies)
+		if err != nil {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "Unable to determine caller address, \"source_ip\" must be provided",
+				Err:     err,
+			})
+			return
+		}
+		req.SourceIP = ip.String()
+	}
+
+	res, err = ws.gm.lookupCountry(req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) postLookupBatch(request *restful.Request, response *restful.Response) {
+	var (
+		res *BatchLookupResult
+		err error
+
+		req  = new(BatchLookupRequest)
+		body = newBatchBody(response.ResponseWriter, request.Request.Body, int64(ws.gm.maxBatchSize)*maxStreamLineSize)
+	)
+
+	request.Request.Body = body
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if body.exceeded() {
+			handleResult(response, nil, body.tooLargeError())
+			return
+		}
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	if acceptLanguage := request.HeaderParameter("Accept-Language"); acceptLanguage != "" {
+		for i := range req.Requests {
+			if req.Requests[i].Locale == "" {
+				req.Requests[i].Locale = acceptLanguage
+			}
+		}
+		if req.Policy != nil && req.Policy.Locale == "" {
+			req.Policy.Locale = acceptLanguage
+		}
+	}
+
+	res, err = ws.gm.lookupBatch(*req)
+	handleResult(response, res, err)
+}
+
+// postLookupStream writes one ndjson record per input line and flushes after each, so neither side of the stream
+// is ever held in memory
+func (ws *webservice) postLookupStream(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+
+	// without full duplex the HTTP/1.x server discards the unread request body as soon as the first record is
+	// flushed.  HTTP/2 streams are always full duplex.
+	if err := http.NewResponseController(response.ResponseWriter).EnableFullDuplex(); err != nil && request.Request.ProtoMajor < 2 {
+		handleResult(response, nil, LookupError{
+			Code:    http.StatusInternalServerError,
+			Message: "Streamed lookups require full duplex http",
+			Err:     err,
+		})
+		return
+	}
+
+	// the status is written along with the first record, after the body has been read from.  Writing it earlier
+	// would refuse an "Expect: 100-continue" request body.
+	response.Header().Set("Content-Type", mimeNDJSON)
+
+	enc := json.NewEncoder(response)
+
+	err := ws.gm.lookupStream(request.Request.Body, request.HeaderParameter("Accept-Language"), func(item StreamLookupItem) error {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		response.Flush()
+		return nil
+	})
+	if err != nil {
+		ws.log.Error().Err(err).Msg("Streamed lookup request aborted")
+	}
+}
+
+func (ws *webservice) postCity(request *restful.Request, response *restful.Response) {
+	var (
+		res *CityLookupResult
+		err error
+
+		req = new(CityLookupRequest)
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	if req.Locale == "" {
+		req.Locale = request.HeaderParameter("Accept-Language")
+	}
+
+	res, err = ws.gm.lookupCity(*req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) getHealthz(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+	handleResult(response, ws.gm.health(), nil)
+}
+
+// getReadyz responds with a 503 until every edition is loaded, answers the canary lookup and is recent enough
+func (ws *webservice) getReadyz(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+	res := ws.gm.readiness()
+	if !res.Ready {
+		_ = response.WriteHeaderAndEntity(http.StatusServiceUnavailable, res)
+		return
+	}
+	handleResult(response, res, nil)
+}
+
+// observeLatency is a container filter recording the latency of each request against its route template, so
+// "/gipman/policies/{id}" is a single series however many policies exist
+func (ws *webservice) observeLatency(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+	chain.ProcessFilter(request, response)
+
+	route := "unmatched"
+	if _, r, err := (restful.CurlyRouter{}).SelectRoute(ws.container.RegisteredWebServices(), request.Request); err == nil {
+		route = r.Path
+	}
+	ws.gm.metrics.observeRequest(route, request.Request.Method, response.StatusCode(), time.Since(start))
+}
+
+// serveMetrics writes all metrics in the prometheus text exposition format
+func (ws *webservice) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", mimePrometheusText)
+	if err := ws.gm.metrics.writeTo(w, ws.gm.registry.snapshot(), time.Now()); err != nil {
+		ws.log.Error().Err(err).Msg("Error writing metrics")
+	}
+}
+
+func (ws *webservice) getLocales(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+	handleResult(response, ws.gm.locales(), nil)
+}
+
+func (ws *webservice) postASN(request *restful.Request, response *restful.Response) {
+	var (
+		res *ASNLookupResult
+		err error
+
+		req = new(ASNLookupRequest)
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	res, err = ws.gm.lookupASN(*req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) postAnonymousIP(request *restful.Request, response *restful.Response) {
+	var (
+		res *AnonymousIPLookupResult
+		err error
+
+		req = new(AnonymousIPLookupRequest)
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	res, err = ws.gm.lookupAnonymousIP(*req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) postEnrich(request *restful.Request, response *restful.Response) {
+	var (
+		res *EnrichLookupResult
+		err error
+
+		req = new(EnrichLookupRequest)
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	res, err = ws.gm.lookupEnrich(*req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) getPolicies(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+	handleResult(response, ws.gm.policies.list(), nil)
+}
+
+func (ws *webservice) getPolicy(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+
+	id := request.PathParameter("policy_id")
+	if p, ok := ws.gm.policies.get(id); ok {
+		handleResult(response, p, nil)
+		return
+	}
+
+	handleResult(response, nil, LookupError{
+		Code:    http.StatusNotFound,
+		Message: fmt.Sprintf("Policy %q not found", id),
+	})
+}
+
+func (ws *webservice) putPolicy(request *restful.Request, response *restful.Response) {
+	var (
+		err error
+
+		id = request.PathParameter("policy_id")
+		p  = new(Policy)
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(p); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		handleResult(response, nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: "request body must be a policy",
+			Err:     err,
+		})
+		return
+	}
+
+	if p.ID == "" {
+		p.ID = id
+	} else if p.ID != id {
+		handleResult(response, nil, LookupError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Policy id %q does not match path id %q", p.ID, id),
+		})
+		return
+	}
+
+	if err = ws.gm.policies.put(*p); err != nil {
+		ws.log.Error().Err(err).Object("policy", p).Msg("Error saving policy")
+		handleResult(response, nil, err)
+		return
+	}
+
+	ws.log.Info().Object("policy", p).Msg("Policy saved")
+	handleResult(response, p, nil)
+}
+
+func (ws *webservice) deletePolicy(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+
+	id := request.PathParameter("policy_id")
+	found, err := ws.gm.policies.delete(id)
+	if err != nil {
+		ws.log.Error().Err(err).Str("policy_id", id).Msg("Error deleting policy")
+		handleResult(response, nil, err)
+		return
+	}
+	if !found {
+		handleResult(response, nil, LookupError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("Policy %q not found", id),
+		})
+		return
+	}
+
+	ws.log.Info().Str("policy_id", id).Msg("Policy deleted")
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func (ws *webservice) initPolicyRoutes() *restful.WebService {
+	rws := new(restful.WebService)
+	rws.Path("/gipman/policies").
+		Doc("Named lookup policies, referenced by \"policy_id\" in lookup requests")
+	rws.Route(rws.GET("").
+		To(ws.getPolicies).
+		Doc("Lists all policies").
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), []Policy{}))
+	rws.Route(rws.GET("/{policy_id}").
+		To(ws.getPolicy).
+		Doc("Returns a single policy").
+		Param(rws.PathParameter("policy_id", "Policy ID")).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), Policy{}).
+		Returns(http.StatusNotFound, http.StatusText(http.StatusNotFound), LookupError{}))
+	rws.Route(rws.PUT("/{policy_id}").
+		To(ws.putPolicy).
+		Doc("Creates or replaces a policy").
+		Param(rws.PathParameter("policy_id", "Policy ID")).
+		Reads(Policy{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), Policy{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}))
+	rws.Route(rws.DELETE("/{policy_id}").
+		To(ws.deletePolicy).
+		Doc("Deletes a policy").
+		Param(rws.PathParameter("policy_id", "Policy ID")).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusNoContent, http.StatusText(http.StatusNoContent), nil).
+		Returns(http.StatusNotFound, http.StatusText(http.StatusNotFound), LookupError{}))
+
+	return rws
+}
+
+func (ws *webservice) postResolveCountries(request *restful.Request, response *restful.Response) {
+	var (
+		res *CountryResolveResult
+		err error
+
+		req  = new(CountryResolveRequest)
+		body = newBatchBody(response.ResponseWriter, request.Request.Body, int64(ws.gm.maxResolveEntries)*resolveBodyPerEntry)
+	)
+
+	request.Request.Body = body
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if body.exceeded() {
+			handleResult(response, nil, body.tooLargeError())
+			return
+		}
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	if req.Locale == "" {
+		req.Locale = request.HeaderParameter("Accept-Language")
+	}
+
+	res, err = ws.gm.resolveCountries(*req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) getCountries(request *restful.Request, response *restful.Response) {
+	defer CleanupHTTPRequestBody(request)
+
+	locale := request.QueryParameter("locale")
+	if locale == "" {
+		locale = request.HeaderParameter("Accept-Language")
+	}
+
+	res, err := ws.gm.countryCatalog(locale)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) postLookupV2(request *restful.Request, response *restful.Response) {
+	var (
+		res *LookupDecision
+		err error
+
+		req = new(LookupRequest)
+	)
+
+	defer CleanupHTTPRequestBody(request)
+
+	if err = request.ReadEntity(req); err != nil {
+		ws.log.Error().Err(err).Msg("Error reading request entity")
+		if errors.Is(err, io.EOF) {
+			handleResult(response, nil, LookupError{
+				Code:    http.StatusBadRequest,
+				Message: "request body cannot be empty",
+				Err:     err,
+			})
+			return
+		}
+	}
+
+	if req.Locale == "" {
+		req.Locale = request.HeaderParameter("Accept-Language")
+	}
+
+	res, err = ws.gm.lookupV2(*req)
+	handleResult(response, res, err)
+}
+
+func (ws *webservice) initV2Routes() *restful.WebService {
+	rws := new(restful.WebService)
+	rws.Path("/gipman/v2")
+	rws.Route(rws.POST("/lookup").
+		To(ws.postLookupV2).
+		Doc("Returns an allowed / denied decision for the Source IP with its reason, the matches, the resolved geo record and the database the lookup was answered from").
+		Reads(LookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), LookupDecision{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+
+	return rws
+}
+
+func (ws *webservice) initCountryRoutes() *restful.WebService {
+	rws := new(restful.WebService)
+	rws.Path("/gipman/countries")
+	rws.Route(rws.GET("").
+		To(ws.getCountries).
+		Doc("Lists every country and continent named in the loaded database, with GeoNameIDs and all localized names").
+		Param(rws.QueryParameter("locale", "Locale of the name field, defaults to the request's Accept-Language header, falling back to English")).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), CountryCatalogResult{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.POST("/resolve").
+		To(ws.postResolveCountries).
+		Doc("Resolves country list entries to the canonical country or continent each one matches, suggesting similar names from the loaded database for entries that do not resolve").
+		Reads(CountryResolveRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), CountryResolveResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+
+	return rws
+}
+
 func (ws *webservice) initRoutes() *restful.WebService {
 	rws := new(restful.WebService)
 	rws.Path("/gipman")
@@ -106,12 +645,121 @@ func (ws *webservice) initRoutes() *restful.WebService {
 		Returns(http.StatusOK, http.StatusText(http.StatusOK), nil))
 	rws.Route(rws.POST("/lookup").
 		To(ws.postLookup).
-		Doc("Determines whether the Source IP is in within the white listed countries").
+		Doc("Determines whether the Source IP is in within the white listed countries or autonomous systems, or is allowed by the referenced policy.  locale, explain and include are refused with a 400, use /gipman/v2/lookup for them.").
 		Reads(LookupRequest{}).
 		Consumes(restful.MIME_JSON).
 		Produces(restful.MIME_JSON).
 		Returns(http.StatusOK, http.StatusText(http.StatusOK), LookupResult{}).
-		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}))
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.GET("/lookup").
+		To(ws.getLookup).
+		Doc("Determines whether the Source IP is within the listed countries or autonomous systems, or is allowed by the referenced policy.  When source_ip is omitted the caller's address is used, honoring forwarding headers only from trusted proxies.").
+		Param(rws.QueryParameter("source_ip", "Source IP, defaults to the caller's address")).
+		Param(rws.QueryParameter("countries", "Comma separated whitelist countries, may be repeated").AllowMultiple(true)).
+		Param(rws.QueryParameter("asns", "Comma separated whitelist autonomous systems, may be repeated").AllowMultiple(true)).
+		Param(rws.QueryParameter("blacklist_countries", "Comma separated blacklist countries, may be repeated").AllowMultiple(true)).
+		Param(rws.QueryParameter("blacklist_asns", "Comma separated blacklist autonomous systems, may be repeated").AllowMultiple(true)).
+		Param(rws.QueryParameter("reject_anonymous", "Comma separated anonymous flags to reject, may be repeated").AllowMultiple(true)).
+		Param(rws.QueryParameter("policy_id", "Named policy to apply instead of lists")).
+		Param(rws.QueryParameter("minimum_confidence", "Minimum country confidence").DataType("integer")).
+		Param(rws.QueryParameter("match_on", "Country to match against, one of located, registered, represented or any")).
+		Param(rws.QueryParameter("fallback", "Comma separated countries tried in order when matching, from located, registered and represented")).
+		Param(rws.QueryParameter("default_decision", "Decision for Source IPs without a country in the database, one of allowed or denied")).
+		Param(rws.QueryParameter("special_addresses", "Whether private, reserved and bogon addresses are allowed, one of allow or deny")).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), LookupResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.POST("/lookup/batch").
+		To(ws.postLookupBatch).
+		Doc("Returns an allowed / denied decision for each entry of the batch, in request order.  Errors are reported per entry.").
+		Reads(BatchLookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), BatchLookupResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge), LookupError{}))
+	rws.Route(rws.POST("/lookup/stream").
+		To(ws.postLookupStream).
+		Doc("Evaluates newline delimited lookup requests, streaming back one newline delimited result per input line as it is evaluated.  Malformed lines produce an error record.").
+		Reads(LookupRequest{}).
+		Consumes(mimeNDJSON, restful.MIME_JSON, "text/plain").
+		Produces(mimeNDJSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), StreamLookupItem{}))
+	rws.Route(rws.POST("/decide").
+		To(ws.postLookupV2).
+		Doc("Deprecated alias of /gipman/v2/lookup").
+		Deprecate().
+		Reads(LookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), LookupDecision{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.POST("/city").
+		To(ws.postCity).
+		Doc("Returns the city, subdivisions, postal code and location of the Source IP").
+		Reads(CityLookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), CityLookupResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusUnprocessableEntity, http.StatusText(http.StatusUnprocessableEntity), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.GET("/healthz").
+		To(ws.getHealthz).
+		Doc("Liveness check, succeeds while the process is running").
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), HealthResult{}))
+	rws.Route(rws.GET("/readyz").
+		To(ws.getReadyz).
+		Doc("Readiness check, succeeds once every configured edition is loaded, answers a canary lookup and is no older than the configured maximum data age").
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), ReadinessResult{}).
+		Returns(http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable), ReadinessResult{}))
+	rws.Route(rws.GET("/locales").
+		To(ws.getLocales).
+		Doc("Lists the locales names may be returned in, as shipped by each loaded edition").
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), LocalesResult{}))
+	rws.Route(rws.POST("/asn").
+		To(ws.postASN).
+		Doc("Returns the autonomous system number and organization of the Source IP").
+		Reads(ASNLookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), ASNLookupResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusUnprocessableEntity, http.StatusText(http.StatusUnprocessableEntity), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.POST("/anonymous").
+		To(ws.postAnonymousIP).
+		Doc("Flags whether the Source IP belongs to an anonymous VPN, Tor exit node, public proxy or hosting provider").
+		Reads(AnonymousIPLookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), AnonymousIPLookupResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusUnprocessableEntity, http.StatusText(http.StatusUnprocessableEntity), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
+	rws.Route(rws.POST("/enrich").
+		To(ws.postEnrich).
+		Doc("Returns the ISP, organization, connection type and domain of the Source IP from the configured enrichment editions").
+		Reads(EnrichLookupRequest{}).
+		Consumes(restful.MIME_JSON).
+		Produces(restful.MIME_JSON).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), EnrichLookupResult{}).
+		Returns(http.StatusBadRequest, http.StatusText(http.StatusBadRequest), LookupError{}).
+		Returns(http.StatusUnprocessableEntity, http.StatusText(http.StatusUnprocessableEntity), LookupError{}).
+		Returns(http.StatusNotImplemented, msgEditionNotConfigured, LookupError{}).
+		Returns(http.StatusServiceUnavailable, msgEditionNotLoaded, LookupError{}))
 
 	return rws
 }
@@ -126,6 +774,11 @@ func (ws *webservice) run(gm *geoman, errc chan<- error) {
 
 	ws.container = restful.NewContainer()
 	ws.container.Add(ws.initRoutes())
+	ws.container.Add(ws.initPolicyRoutes())
+	ws.container.Add(ws.initCountryRoutes())
+	ws.container.Add(ws.initV2Routes())
+	ws.container.Filter(ws.observeLatency)
+	ws.container.Handle("/metrics", http.HandlerFunc(ws.serveMetrics))
 
 	if err := bootstrapSwagger(ws.log, ws.container); err != nil {
 		ws.log.Error().Err(err).Msg("Cannot init openapi docs")